@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/jehiah/sortdb/src/lib/sorteddb"
+)
+
+// logOptions controls which requests are logged and how
+type logOptions struct {
+	format        string  // "common" or "json"
+	sampleRate    float64 // fraction of requests to log
+	slowThreshold time.Duration
+}
+
+// requestInfo holds details of a query for the access log. httpServer fills
+// it in through the request context.
+type requestInfo struct {
+	keys       int
+	seeks      uint64
+	generation uint64
+	aborted    bool
+}
+
+type requestInfoKey struct{}
+
+// withRequestInfo returns req with a requestInfo added to its context, which
+// also counts the seeks made by queries using that context
+func withRequestInfo(req *http.Request) (*http.Request, *requestInfo) {
+	info := &requestInfo{}
+	ctx := context.WithValue(req.Context(), requestInfoKey{}, info)
+	ctx = sorteddb.WithSeekCounter(ctx, &info.seeks)
+	return req.WithContext(ctx), info
+}
+
+// logQuery records the number of lookups in a query (each /get or /mget key,
+// and the prefix or key range of /fwmatch and /range) and the DB generation
+// it ran against for the access log
+func logQuery(req *http.Request, keys int, generation uint64) {
+	if info, ok := req.Context().Value(requestInfoKey{}).(*requestInfo); ok {
+		info.keys = keys
+		info.generation = generation
+	}
+}
+
+// logSeeks adds seeks made outside of a context aware query (eg: positioning
+// an Iterator) to the access log
+func logSeeks(ctx context.Context, seeks uint64) {
+	if info, ok := ctx.Value(requestInfoKey{}).(*requestInfo); ok {
+		atomic.AddUint64(&info.seeks, seeks)
+	}
+}
+
+type accessLogEntry struct {
+	Time       string  `json:"time"`
+	RemoteAddr string  `json:"remote_addr"`
+	Method     string  `json:"method"`
+	URI        string  `json:"uri"`
+	Endpoint   string  `json:"endpoint"`
+	Status     int     `json:"status"`
+	Bytes      int     `json:"bytes"`
+	Keys       int     `json:"keys,omitempty"`
+	Seeks      uint64  `json:"seeks"`
+	Generation uint64  `json:"generation,omitempty"`
+	Aborted    bool    `json:"aborted,omitempty"`
+	Duration   float64 `json:"duration"` // Seconds
+	UserAgent  string  `json:"user_agent"`
+}
+
+// buildJSONLogLine is like buildLogLine but returns a line of JSON including
+// the details of the query from info
+func buildJSONLogLine(req *http.Request, url url.URL, ts time.Time, status int, size int, info *requestInfo) []byte {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	// keep & and < in URIs readable
+	enc.SetEscapeHTML(false)
+	err = enc.Encode(accessLogEntry{
+		Time:       ts.Format("2006-01-02T15:04:05.000Z07:00"),
+		RemoteAddr: host,
+		Method:     req.Method,
+		URI:        url.RequestURI(),
+		Endpoint:   url.Path,
+		Status:     status,
+		Bytes:      size,
+		Keys:       info.keys,
+		Seeks:      atomic.LoadUint64(&info.seeks),
+		Generation: info.generation,
+		Aborted:    info.aborted,
+		Duration:   time.Since(ts).Seconds(),
+		UserAgent:  req.UserAgent(),
+	})
+	if err != nil {
+		log.Printf("ERROR: %s", err)
+		return nil
+	}
+	return b.Bytes()
+}
+
+// logFile is an access log file that can be reopened (eg: after logrotate
+// has moved it aside)
+type logFile struct {
+	sync.Mutex
+	path string
+	f    *os.File
+}
+
+func openLogFile(path string) (*logFile, error) {
+	l := &logFile{path: path}
+	return l, l.Reopen()
+}
+
+func (l *logFile) Reopen() error {
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	l.Lock()
+	previous := l.f
+	l.f = f
+	l.Unlock()
+	if previous != nil {
+		previous.Close()
+	}
+	return nil
+}
+
+func (l *logFile) Write(b []byte) (int, error) {
+	l.Lock()
+	defer l.Unlock()
+	return l.f.Write(b)
+}
+
+// ReopenLoop reopens the log file each time a USR1 signal is received
+func (l *logFile) ReopenLoop() {
+	usr1Chan := make(chan os.Signal, 1)
+	signal.Notify(usr1Chan, syscall.SIGUSR1)
+	for {
+		<-usr1Chan
+		log.Printf("reopening %s", l.path)
+		err := l.Reopen()
+		if err != nil {
+			log.Printf("ERROR: reopening %s", err)
+		}
+	}
+}
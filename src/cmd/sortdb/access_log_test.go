@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAccessLog(t *testing.T) {
+	s, cleanup := newTestServer(t, "a\t1\nb\t2\nc\t3\n")
+	defer cleanup()
+
+	var out bytes.Buffer
+	h := LoggingHandler(&out, s, logOptions{format: "json", sampleRate: 1})
+	for _, tc := range []struct {
+		url  string
+		keys int
+	}{
+		{"/get?key=a", 1},
+		{"/mget?key=a&key=b&key=z", 3},
+		{"/fwmatch?key=a", 1},
+		{"/range?start=a&end=c", 1},
+	} {
+		out.Reset()
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", tc.url, nil))
+		var entry accessLogEntry
+		if err := json.Unmarshal(out.Bytes(), &entry); err != nil {
+			t.Fatalf("%s got error %s for %q", tc.url, err, out.String())
+		}
+		if entry.Keys != tc.keys || entry.Status != 200 || entry.Aborted {
+			t.Errorf("%s got %+v expected keys %d", tc.url, entry, tc.keys)
+		}
+	}
+
+	// an aborted response is logged before the panic reaches net/http
+	out.Reset()
+	h = LoggingHandler(&out, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		io.WriteString(w, "a\t1\n") // nolint:errcheck
+		panic(http.ErrAbortHandler)
+	}), logOptions{format: "json", sampleRate: 1})
+	func() {
+		defer func() {
+			if p := recover(); p != http.ErrAbortHandler {
+				t.Errorf("got panic %v expected %v", p, http.ErrAbortHandler)
+			}
+		}()
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/range?start=a&end=c", nil))
+	}()
+	var entry accessLogEntry
+	if err := json.Unmarshal(out.Bytes(), &entry); err != nil {
+		t.Fatalf("got error %s for %q", err, out.String())
+	}
+	if !entry.Aborted || entry.Status != 200 || entry.Bytes != 4 {
+		t.Errorf("got %+v expected an aborted request", entry)
+	}
+}
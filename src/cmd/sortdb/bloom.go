@@ -0,0 +1,69 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"github.com/jehiah/sortdb/src/lib/sorteddb"
+)
+
+// bloomCommand implements `sortdb bloom` which writes a bloom filter sidecar
+// for a db file that is loaded at startup with -bloom-false-positive-rate.
+// It returns the process exit code.
+func bloomCommand(args []string) int {
+	flagSet := flag.NewFlagSet("bloom", flag.ExitOnError)
+	file := flagSet.String("db-file", "", "db file")
+	fieldSeparator := flagSet.String("field-separator", "\t", "field separator (eg: comma, tab, pipe)")
+	quoted := flagSet.Bool("quoted", false, "fields may be quoted with \" (RFC 4180 csv)")
+	header := flagSet.Bool("header", false, "the first line of the db file is a header row of column names")
+	falsePositiveRate := flagSet.Float64("false-positive-rate", 0.01, "bloom filter false positive rate")
+	output := flagSet.String("output", "", "output file (default: db file with a .bloom suffix)")
+	flagSet.Parse(args) // nolint:errcheck
+
+	if *file == "" && flagSet.NArg() == 1 {
+		*file = flagSet.Arg(0)
+	}
+	if len(*fieldSeparator) != 1 {
+		log.Fatalf("Error: invalid field separator %q", *fieldSeparator)
+	}
+	if *falsePositiveRate <= 0 || *falsePositiveRate >= 1 {
+		log.Fatalf("Error: invalid false positive rate %v", *falsePositiveRate)
+	}
+	if *output == "" {
+		*output = *file + sorteddb.BloomFileSuffix
+	}
+
+	f, err := os.Open(*file)
+	if err != nil {
+		log.Fatalf("ERROR opening %q %s", *file, err)
+	}
+	db := &sorteddb.DB{RecordSeparator: []byte(*fieldSeparator)[0], LineEnding: '\n', Quoted: *quoted, HasHeader: *header}
+	err = db.Open(f)
+	if err != nil {
+		log.Fatalf("ERROR creating db %s", err)
+	}
+	defer db.Close()
+
+	// write to a temporary file and rename so a running sortdb never
+	// reads a partial filter
+	tmp := *output + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		log.Fatalf("ERROR creating %q %s", tmp, err)
+	}
+	err = db.WriteBloomFilter(out, *falsePositiveRate)
+	if err == nil {
+		err = out.Close()
+	}
+	if err == nil {
+		err = os.Rename(tmp, *output)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		log.Printf("ERROR writing bloom filter %s", err)
+		return 1
+	}
+	log.Printf("wrote %s", *output)
+	return 0
+}
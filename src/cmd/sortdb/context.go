@@ -4,6 +4,8 @@ import (
 	"log"
 	"net"
 	"os"
+	"sync"
+	"time"
 
 	"github.com/jehiah/sortdb/src/lib/sorteddb"
 	"github.com/jehiah/sortdb/src/lib/util"
@@ -15,6 +17,30 @@ type Context struct {
 	httpListener net.Listener
 	reloadChan   chan int
 	waitGroup    util.WaitGroupWrapper
+
+	requestTimeout           time.Duration
+	maxResponseBytes         int
+	maxBufferedResponseBytes int
+
+	statsd           *statsdClient
+	statsWindows     []statsWindow
+	statsPercentiles []float64
+
+	// remapMutex serializes reloads; statusMutex only guards reloadStatus so
+	// that reading it doesn't wait on a remap in progress
+	remapMutex   sync.Mutex
+	statusMutex  sync.Mutex
+	reloadStatus reloadStatus
+}
+
+// reloadStatus records the outcome of attempts to remap the DB
+type reloadStatus struct {
+	Reloads       uint64 `json:"reloads"`
+	Failures      uint64 `json:"failures"`
+	LastAttempt   int64  `json:"last_attempt"`
+	LastSuccess   int64  `json:"last_success"`
+	LastError     string `json:"last_error"`
+	LastErrorTime int64  `json:"last_error_time"`
 }
 
 func verifyAddress(arg string, address string) *net.TCPAddr {
@@ -27,13 +53,51 @@ func verifyAddress(arg string, address string) *net.TCPAddr {
 	return addr
 }
 
+// Reload remaps the DB. On failure the previous mapping remains in use and
+// the error is recorded in the reload status.
+func (c *Context) Reload() error {
+	c.remapMutex.Lock()
+	defer c.remapMutex.Unlock()
+
+	now := time.Now().Unix()
+	c.statusMutex.Lock()
+	c.reloadStatus.LastAttempt = now
+	c.statusMutex.Unlock()
+
+	err := c.db.Remap()
+
+	c.statusMutex.Lock()
+	if err != nil {
+		c.reloadStatus.Failures++
+		c.reloadStatus.LastError = err.Error()
+		c.reloadStatus.LastErrorTime = now
+	} else {
+		c.reloadStatus.Reloads++
+		c.reloadStatus.LastSuccess = now
+		c.reloadStatus.LastError = ""
+	}
+	c.statusMutex.Unlock()
+
+	if err != nil {
+		log.Printf("ERROR remapping DB %q", err)
+		c.statsd.Incr("reload_failures")
+		return err
+	}
+	c.statsd.Incr("reloads")
+	return nil
+}
+
+// ReloadStatus returns a copy of the current reload status
+func (c *Context) ReloadStatus() reloadStatus {
+	c.statusMutex.Lock()
+	defer c.statusMutex.Unlock()
+	return c.reloadStatus
+}
+
 func (c *Context) ReloadLoop() {
 	for {
 		<-c.reloadChan
-		err := c.db.Remap()
-		if err != nil {
-			log.Fatalf("ERROR remapping DB %q", err)
-		}
+		c.Reload() // nolint:errcheck
 	}
 
 }
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/jehiah/sortdb/src/lib/sorteddb"
+)
+
+var (
+	errInvalidFields = errors.New("INVALID_ARG_FIELDS")
+	errNoHeader      = errors.New("NO_HEADER")
+)
+
+// projection lists the columns (the key is column 0) selected by the fields
+// argument of a request
+type projection []int
+
+// parseProjection reads the fields argument, a comma separated list of
+// column names from the header row or column numbers starting at 1 for the
+// key (as with cut -f). A nil projection selects every column.
+func (s *httpServer) parseProjection(req *http.Request) (projection, error) {
+	v := req.FormValue("fields")
+	if v == "" {
+		return nil, nil
+	}
+	columns := s.ctx.db.Columns()
+	var p projection
+	for _, name := range strings.Split(v, ",") {
+		if i := indexOf(columns, name); i >= 0 {
+			p = append(p, i)
+			continue
+		}
+		n, err := strconv.Atoi(name)
+		switch {
+		case err == nil && n > 0:
+			p = append(p, n-1)
+		case err != nil && columns == nil:
+			return nil, errNoHeader
+		default:
+			return nil, errInvalidFields
+		}
+	}
+	return p, nil
+}
+
+func indexOf(columns []string, name string) int {
+	for i, c := range columns {
+		if c == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// apply returns the selected columns of record
+func (p projection) apply(db *sorteddb.DB, record []byte) []byte {
+	return db.SelectFields(record, p)
+}
+
+type schemaResponse struct {
+	Columns []string `json:"columns"`
+}
+
+func (s *httpServer) schemaHandler(w http.ResponseWriter, req *http.Request) {
+	columns := s.ctx.db.Columns()
+	if columns == nil {
+		http.Error(w, errNoHeader.Error(), 404)
+		return
+	}
+	response, err := json.Marshal(schemaResponse{Columns: columns})
+	if err != nil {
+		log.Printf("%s", err)
+		http.Error(w, "INTERNAL_ERROR", 500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Content-Length", strconv.Itoa(len(response)))
+	w.WriteHeader(200)
+	w.Write(response) // nolint:errcheck
+}
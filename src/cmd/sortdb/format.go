@@ -0,0 +1,241 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/jehiah/sortdb/src/lib/sorteddb"
+)
+
+var errInvalidFormat = errors.New("INVALID_ARG_FORMAT")
+
+// outputFormat is the encoding of query responses
+type outputFormat int
+
+const (
+	formatText outputFormat = iota
+	formatJSON
+	formatNDJSON
+)
+
+// parseFormat reads the format argument, falling back to the supported type
+// of the Accept header with the highest quality (the first listed on a tie)
+func parseFormat(req *http.Request) (outputFormat, error) {
+	switch req.FormValue("format") {
+	case "text":
+		return formatText, nil
+	case "json":
+		return formatJSON, nil
+	case "ndjson":
+		return formatNDJSON, nil
+	case "":
+	default:
+		return formatText, errInvalidFormat
+	}
+	format, best := formatText, 0.0
+	for _, accept := range strings.Split(req.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			q, err = strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+		}
+		if q <= best {
+			continue
+		}
+		switch mediaType {
+		case "text/plain", "text/*", "*/*":
+			format, best = formatText, q
+		case "application/json":
+			format, best = formatJSON, q
+		case "application/x-ndjson", "application/ndjson":
+			format, best = formatNDJSON, q
+		}
+	}
+	return format, nil
+}
+
+// recordEncoder renders the records of a query response in the requested
+// format. In the JSON formats each record is an array of its fields, or an
+// object keyed by column name when the db file has a header row.
+type recordEncoder struct {
+	db     *sorteddb.DB
+	format outputFormat
+	fields projection
+	// valueOnly skips the key (unless selected by fields)
+	valueOnly bool
+	// keyed renders a JSON object of values keyed by the record key
+	keyed   bool
+	records int
+}
+
+// newEncoder returns a recordEncoder for the fields and format arguments of req
+func (s *httpServer) newEncoder(req *http.Request) (*recordEncoder, error) {
+	fields, err := s.parseProjection(req)
+	if err != nil {
+		return nil, err
+	}
+	format, err := parseFormat(req)
+	if err != nil {
+		return nil, err
+	}
+	return &recordEncoder{db: s.ctx.db, format: format, fields: fields}, nil
+}
+
+// raw returns true if records are sent unmodified
+func (e *recordEncoder) raw() bool {
+	return e.format == formatText && e.fields == nil && !e.valueOnly
+}
+
+func (e *recordEncoder) contentType() string {
+	switch e.format {
+	case formatJSON:
+		return "application/json; charset=utf-8"
+	case formatNDJSON:
+		return "application/x-ndjson; charset=utf-8"
+	}
+	return "text/plain"
+}
+
+// appendValue appends a single record to b
+func (e *recordEncoder) appendValue(b []byte, record []byte) []byte {
+	if e.format != formatText {
+		return e.appendJSON(b, record)
+	}
+	switch {
+	case e.fields != nil:
+		record = e.fields.apply(e.db, record)
+	case e.valueOnly:
+		_, record, _ = e.db.SplitKey(record)
+	}
+	return append(b, record...)
+}
+
+// appendRecord appends a record (for key when keyed) as the next entry of a
+// response
+func (e *recordEncoder) appendRecord(b []byte, key []byte, record []byte) []byte {
+	switch {
+	case e.format == formatJSON:
+		switch {
+		case e.records > 0:
+			b = append(b, ',')
+		case e.keyed:
+			b = append(b, '{')
+		default:
+			b = append(b, '[')
+		}
+		if e.keyed {
+			b = appendJSONString(b, key)
+			b = append(b, ':')
+		}
+		b = e.appendValue(b, record)
+	case e.format == formatNDJSON && e.keyed:
+		b = append(b, `{"key":`...)
+		b = appendJSONString(b, key)
+		b = append(b, `,"value":`...)
+		b = e.appendValue(b, record)
+		b = append(b, '}', '\n')
+	case e.format == formatNDJSON:
+		b = e.appendValue(b, record)
+		b = append(b, '\n')
+	default:
+		b = e.appendValue(b, record)
+		b = append(b, e.db.LineEnding)
+	}
+	e.records++
+	return b
+}
+
+// appendMiss appends the marker for a key that was not found as the next
+// entry of a response: an empty line, or a null value in the JSON formats
+func (e *recordEncoder) appendMiss(b []byte, key []byte) []byte {
+	switch e.format {
+	case formatJSON:
+		if e.records > 0 {
+			b = append(b, ',')
+		} else {
+			b = append(b, '{')
+		}
+		b = appendJSONString(b, key)
+		b = append(b, `:null`...)
+	case formatNDJSON:
+		b = append(b, `{"key":`...)
+		b = appendJSONString(b, key)
+		b = append(b, `,"value":null}`...)
+		b = append(b, '\n')
+	default:
+		b = append(b, e.db.LineEnding)
+	}
+	e.records++
+	return b
+}
+
+// appendEnd completes a response of zero or more records. Empty responses
+// are left empty so that they can be answered with a HTTP 404.
+func (e *recordEncoder) appendEnd(b []byte) []byte {
+	if e.format != formatJSON || e.records == 0 {
+		return b
+	}
+	if e.keyed {
+		return append(b, '}', '\n')
+	}
+	return append(b, ']', '\n')
+}
+
+// appendJSON appends the fields of record as a JSON array, or an object
+// keyed by column name when the DB has a header row
+func (e *recordEncoder) appendJSON(b []byte, record []byte) []byte {
+	all := e.db.SplitFields(record)
+	positions := []int(e.fields)
+	if positions == nil {
+		start := 0
+		if e.valueOnly {
+			start = 1
+		}
+		for i := start; i < len(all); i++ {
+			positions = append(positions, i)
+		}
+	}
+	columns := e.db.Columns()
+	if columns == nil {
+		b = append(b, '[')
+	} else {
+		b = append(b, '{')
+	}
+	for i, n := range positions {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		if columns != nil {
+			name := strconv.Itoa(n + 1)
+			if n < len(columns) {
+				name = columns[n]
+			}
+			b = appendJSONString(b, []byte(name))
+			b = append(b, ':')
+		}
+		var v []byte
+		if n < len(all) {
+			v = e.db.Unquote(all[n])
+		}
+		b = appendJSONString(b, v)
+	}
+	if columns == nil {
+		return append(b, ']')
+	}
+	return append(b, '}')
+}
+
+func appendJSONString(b []byte, s []byte) []byte {
+	j, _ := json.Marshal(string(s)) // nolint:errcheck
+	return append(b, j...)
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseFormat(t *testing.T) {
+	for _, tc := range []struct {
+		args, accept string
+		expected     outputFormat
+	}{
+		{"", "", formatText},
+		{"", "application/json", formatJSON},
+		{"", "text/html, application/x-ndjson", formatNDJSON},
+		{"", "application/json, text/plain", formatJSON},
+		{"", "application/json;q=0.1, text/plain", formatText},
+		{"", "text/plain;q=0.5, application/json;q=0.9", formatJSON},
+		{"", "application/json;q=0, */*", formatText},
+		{"", "application/json;q=0", formatText},
+		{"", "application/json;q=x, application/x-ndjson;q=0.2", formatNDJSON},
+		{"format=text", "application/json", formatText},
+	} {
+		req := httptest.NewRequest("GET", "/get?"+tc.args, nil)
+		req.Header.Set("Accept", tc.accept)
+		if got, err := parseFormat(req); err != nil || got != tc.expected {
+			t.Errorf("%q Accept: %q got %v %v expected %v", tc.args, tc.accept, got, err, tc.expected)
+		}
+	}
+	if _, err := parseFormat(httptest.NewRequest("GET", "/get?format=xml", nil)); err != errInvalidFormat {
+		t.Errorf("got error %v expected %s", err, errInvalidFormat)
+	}
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"math/bits"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	errInvalidWindows     = errors.New("invalid stats windows")
+	errInvalidPercentiles = errors.New("invalid stats percentiles")
+)
+
+const (
+	// each power of two is divided into 1<<histogramSubBucketBits buckets so
+	// recorded durations are accurate to within ~3% (as in HdrHistogram)
+	histogramSubBucketBits = 5
+	// durations longer than histogramMaxValue (~18m) are recorded as
+	// histogramMaxValue (although the max is exact)
+	histogramMaxValue = 1<<40 - 1
+)
+
+var histogramBuckets = bucketIndex(histogramMaxValue) + 1
+
+// bucketIndex returns the bucket for a duration of v nanoseconds. Values
+// below 2<<histogramSubBucketBits have their own bucket, larger values share
+// a bucket with others having the same leading histogramSubBucketBits+1 bits.
+func bucketIndex(v uint64) int {
+	if v > histogramMaxValue {
+		v = histogramMaxValue
+	}
+	if v < 2<<histogramSubBucketBits {
+		return int(v)
+	}
+	exp := bits.Len64(v) - (histogramSubBucketBits + 1)
+	return exp<<histogramSubBucketBits + int(v>>exp)
+}
+
+// bucketValue returns the largest value recorded in bucket i
+func bucketValue(i int) uint64 {
+	if i < 2<<histogramSubBucketBits {
+		return uint64(i)
+	}
+	exp := i>>histogramSubBucketBits - 1
+	mantissa := uint64(i&(1<<histogramSubBucketBits-1) + 1<<histogramSubBucketBits)
+	return (mantissa+1)<<exp - 1
+}
+
+// histogram counts durations in log-linear buckets
+type histogram struct {
+	counts []uint64 // allocated on first use
+	count  uint64
+	sum    time.Duration
+	max    time.Duration
+}
+
+func (h *histogram) record(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	if h.counts == nil {
+		h.counts = make([]uint64, histogramBuckets)
+	}
+	h.counts[bucketIndex(uint64(d))]++
+	h.count++
+	h.sum += d
+	if d > h.max {
+		h.max = d
+	}
+}
+
+// merge adds the durations recorded in o
+func (h *histogram) merge(o *histogram) {
+	if o.count == 0 {
+		return
+	}
+	if h.counts == nil {
+		h.counts = make([]uint64, histogramBuckets)
+	}
+	for i, c := range o.counts {
+		h.counts[i] += c
+	}
+	h.count += o.count
+	h.sum += o.sum
+	if o.max > h.max {
+		h.max = o.max
+	}
+}
+
+// reset clears h, keeping its buckets for reuse
+func (h *histogram) reset() {
+	for i := range h.counts {
+		h.counts[i] = 0
+	}
+	h.count = 0
+	h.sum = 0
+	h.max = 0
+}
+
+func (h *histogram) Avg() time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+	return h.sum / time.Duration(h.count)
+}
+
+// Percentile returns the duration which p percent of recorded durations are
+// less than or equal to
+func (h *histogram) Percentile(p float64) time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+	rank := uint64(math.Ceil(p / 100 * float64(h.count)))
+	if rank == 0 {
+		rank = 1
+	}
+	var n uint64
+	for i, c := range h.counts {
+		n += c
+		if n >= rank {
+			if v := time.Duration(bucketValue(i)); v < h.max {
+				return v
+			}
+			break
+		}
+	}
+	return h.max
+}
+
+// CountBelow returns the number of recorded durations less than or equal to
+// d (to within the accuracy of the buckets)
+func (h *histogram) CountBelow(d time.Duration) uint64 {
+	var n uint64
+	for i, c := range h.counts {
+		if time.Duration(bucketValue(i)) > d {
+			break
+		}
+		n += c
+	}
+	return n
+}
+
+// statsWindow is a period of time over which request timings are reported
+type statsWindow struct {
+	name     string
+	duration time.Duration
+}
+
+// parseStatsWindows parses a comma separated list of durations (eg:
+// "1m,5m,15m") and returns them ordered from shortest to longest
+func parseStatsWindows(s string) ([]statsWindow, error) {
+	var windows []statsWindow
+	for _, v := range strings.Split(s, ",") {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < time.Second {
+			return nil, errInvalidWindows
+		}
+		windows = append(windows, statsWindow{name: v, duration: d})
+	}
+	sort.SliceStable(windows, func(i, j int) bool { return windows[i].duration < windows[j].duration })
+	return windows, nil
+}
+
+// parsePercentiles parses a comma separated list of percentiles (eg: "95,99,99.9")
+func parsePercentiles(s string) ([]float64, error) {
+	var percentiles []float64
+	for _, v := range strings.Split(s, ",") {
+		p, err := strconv.ParseFloat(v, 64)
+		if err != nil || p <= 0 || p > 100 {
+			return nil, errInvalidPercentiles
+		}
+		percentiles = append(percentiles, p)
+	}
+	return percentiles, nil
+}
+
+// timerMetrics records request durations in a histogram since startup (or
+// the last Reset) and in a ring of short histograms that are merged to report
+// on recent windows of time. A histogram since startup that is never Reset is
+// kept for cumulative metrics.
+type timerMetrics struct {
+	sync.Mutex
+	width    time.Duration // of each slot
+	total    histogram
+	lifetime histogram
+	slots    []histogram
+	slotIDs  []int64 // which period of width each slot holds
+
+	// optionally each duration is also sent to statsd as a timer
+	statsd     *statsdClient
+	statsdStat string
+}
+
+// newTimerMetrics returns a timerMetrics able to report on each window. Slots
+// are a quarter of the shortest window, and as the newest slot is still
+// filling, a window covers between 75% and 100% of its duration.
+func newTimerMetrics(windows []statsWindow) *timerMetrics {
+	var shortest, longest time.Duration
+	for _, w := range windows {
+		if shortest == 0 || w.duration < shortest {
+			shortest = w.duration
+		}
+		if w.duration > longest {
+			longest = w.duration
+		}
+	}
+	t := &timerMetrics{width: shortest / 4}
+	if t.width > 0 {
+		n := int(longest/t.width) + 1
+		t.slots = make([]histogram, n)
+		t.slotIDs = make([]int64, n)
+	}
+	return t
+}
+
+// Status records the duration of a request that started at startTime
+func (t *timerMetrics) Status(startTime time.Time) {
+	now := time.Now()
+	d := now.Sub(startTime)
+	t.record(now, d)
+	t.statsd.Timing(t.statsdStat, d)
+}
+
+func (t *timerMetrics) record(now time.Time, d time.Duration) {
+	t.Lock()
+	defer t.Unlock()
+	t.total.record(d)
+	t.lifetime.record(d)
+	if len(t.slots) == 0 {
+		return
+	}
+	id := now.UnixNano() / int64(t.width)
+	i := int(id % int64(len(t.slots)))
+	if t.slotIDs[i] != id {
+		t.slots[i].reset()
+		t.slotIDs[i] = id
+	}
+	t.slots[i].record(d)
+}
+
+// Window returns the durations recorded in the last window of time, or all
+// durations since startup (or the last Reset) if window is 0
+func (t *timerMetrics) Window(window time.Duration) *histogram {
+	t.Lock()
+	defer t.Unlock()
+	h := &histogram{}
+	if window == 0 || len(t.slots) == 0 {
+		h.merge(&t.total)
+		return h
+	}
+	id := time.Now().UnixNano() / int64(t.width)
+	n := int64((window + t.width - 1) / t.width)
+	for i := range t.slots {
+		if t.slotIDs[i] > id-n && t.slotIDs[i] <= id {
+			h.merge(&t.slots[i])
+		}
+	}
+	return h
+}
+
+// Lifetime returns all durations recorded since startup, regardless of Reset
+func (t *timerMetrics) Lifetime() *histogram {
+	t.Lock()
+	defer t.Unlock()
+	h := &histogram{}
+	h.merge(&t.lifetime)
+	return h
+}
+
+// Reset discards the durations recorded for Window
+func (t *timerMetrics) Reset() {
+	t.Lock()
+	defer t.Unlock()
+	t.total.reset()
+	for i := range t.slots {
+		t.slots[i].reset()
+		t.slotIDs[i] = 0
+	}
+}
+
+// timingStats summarizes the request durations in a window (in microseconds)
+type timingStats map[string]float64
+
+func newTimingStats(h *histogram, percentiles []float64) timingStats {
+	s := timingStats{
+		"count":           float64(h.count),
+		"average_request": microseconds(h.Avg()),
+		"max":             microseconds(h.max),
+	}
+	for _, p := range percentiles {
+		s["p"+strconv.FormatFloat(p, 'f', -1, 64)] = microseconds(h.Percentile(p))
+	}
+	return s
+}
+
+func microseconds(d time.Duration) float64 {
+	return math.Round(float64(d)/float64(time.Microsecond)*1000) / 1000
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBucketBoundaries(t *testing.T) {
+	for _, tc := range []struct {
+		v      uint64
+		bucket int
+		max    uint64
+	}{
+		{0, 0, 0},
+		{1, 1, 1},
+		{63, 63, 63},
+		// above 2<<histogramSubBucketBits buckets hold more than one value
+		{64, 64, 65},
+		{65, 64, 65},
+		{66, 65, 67},
+		{127, 95, 127},
+		{128, 96, 131},
+		{1000, 190, 1007},
+		{histogramMaxValue, histogramBuckets - 1, histogramMaxValue},
+		{histogramMaxValue + 1, histogramBuckets - 1, histogramMaxValue},
+	} {
+		if got := bucketIndex(tc.v); got != tc.bucket {
+			t.Errorf("bucketIndex(%d) got %d expected %d", tc.v, got, tc.bucket)
+		}
+		if got := bucketValue(tc.bucket); got != tc.max {
+			t.Errorf("bucketValue(%d) got %d expected %d", tc.bucket, got, tc.max)
+		}
+	}
+
+	// each bucket starts after the largest value of the previous one and
+	// holds values within 1/32 of each other
+	for i := 1; i < histogramBuckets; i++ {
+		low, high := bucketValue(i-1)+1, bucketValue(i)
+		if bucketIndex(low) != i || bucketIndex(high) != i {
+			t.Fatalf("bucket %d holds [%d, %d] got buckets %d and %d", i, low, high, bucketIndex(low), bucketIndex(high))
+		}
+		if float64(high-low) > float64(low)/(1<<histogramSubBucketBits) {
+			t.Fatalf("bucket %d holds [%d, %d]", i, low, high)
+		}
+	}
+}
+
+func TestHistogramPercentile(t *testing.T) {
+	var h histogram
+	if got := h.Percentile(50); got != 0 {
+		t.Errorf("got %s expected 0 for an empty histogram", got)
+	}
+	for d := time.Duration(1); d <= 60; d++ {
+		h.record(d)
+	}
+	for _, tc := range []struct {
+		p        float64
+		expected time.Duration
+	}{
+		{0.1, 1},
+		{1, 1},
+		{50, 30},
+		{50.1, 31},
+		{95, 57},
+		{100, 60},
+	} {
+		if got := h.Percentile(tc.p); got != tc.expected {
+			t.Errorf("Percentile(%v) got %d expected %d", tc.p, got, tc.expected)
+		}
+	}
+
+	// the largest value of a bucket is reported, but never more than the max
+	h.record(1000)
+	if got := h.Percentile(100); got != 1000 {
+		t.Errorf("Percentile(100) got %d expected 1000", got)
+	}
+	h.record(1001)
+	if got := h.Percentile(99); got != 1001 {
+		t.Errorf("Percentile(99) got %d expected 1001", got)
+	}
+	if got := h.CountBelow(60); got != 60 {
+		t.Errorf("CountBelow(60) got %d expected 60", got)
+	}
+	if h.Avg() != (1830+2001)/62 || h.max != 1001 {
+		t.Errorf("got avg %d max %d", h.Avg(), h.max)
+	}
+}
+
+func TestTimerMetricsWindow(t *testing.T) {
+	tm := newTimerMetrics([]statsWindow{{"1m", time.Minute}, {"5m", 5 * time.Minute}})
+	if tm.width != 15*time.Second || len(tm.slots) != 21 {
+		t.Fatalf("got width %s and %d slots", tm.width, len(tm.slots))
+	}
+
+	now := time.Now()
+	for _, ago := range []time.Duration{
+		10 * time.Minute, // older than every window
+		4 * time.Minute,
+		2 * time.Minute,
+		30 * time.Second,
+		0,
+	} {
+		tm.record(now.Add(-ago), time.Millisecond)
+	}
+	for _, tc := range []struct {
+		window   time.Duration
+		expected uint64
+	}{
+		{time.Minute, 2},
+		{5 * time.Minute, 4},
+		{0, 5},
+	} {
+		if got := tm.Window(tc.window).count; got != tc.expected {
+			t.Errorf("Window(%s) got %d durations expected %d", tc.window, got, tc.expected)
+		}
+	}
+
+	tm.Reset()
+	if got := tm.Window(0).count; got != 0 {
+		t.Errorf("got %d durations after Reset expected 0", got)
+	}
+	if got := tm.Lifetime().count; got != 5 {
+		t.Errorf("got %d lifetime durations after Reset expected 5", got)
+	}
+
+	// a slot is reused once it falls out of the longest window
+	tm = newTimerMetrics([]statsWindow{{"1m", time.Minute}})
+	tm.record(now.Add(-tm.width*time.Duration(len(tm.slots))), time.Millisecond)
+	tm.record(now, time.Millisecond)
+	if got := tm.Window(time.Minute).count; got != 1 {
+		t.Errorf("got %d durations expected 1", got)
+	}
+	if got := tm.Window(0).count; got != 2 {
+		t.Errorf("got %d durations expected 2", got)
+	}
+}
@@ -1,17 +1,18 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"io"
 	"log"
 	"net/http"
 	httpprof "net/http/pprof"
-	"os"
 	"strconv"
 	"sync/atomic"
 	"time"
 
-	"github.com/bitly/timer_metrics"
+	"github.com/jehiah/sortdb/src/lib/sorteddb"
 )
 
 type httpServer struct {
@@ -35,24 +36,25 @@ type httpServer struct {
 	RangeHits     uint64
 	RangeMisses   uint64
 
-	GetMetrics     *timer_metrics.TimerMetrics
-	MgetMetrics    *timer_metrics.TimerMetrics
-	FwMatchMetrics *timer_metrics.TimerMetrics
-	RangeMetrics   *timer_metrics.TimerMetrics
+	GetMetrics     *timerMetrics
+	MgetMetrics    *timerMetrics
+	FwMatchMetrics *timerMetrics
+	RangeMetrics   *timerMetrics
 }
 
-func NewHTTPServer(ctx *Context, logging bool) http.Handler {
-	h := &httpServer{
+func NewHTTPServer(ctx *Context) *httpServer {
+	s := &httpServer{
 		ctx:            ctx,
-		GetMetrics:     timer_metrics.NewTimerMetrics(1500, "/get"),
-		MgetMetrics:    timer_metrics.NewTimerMetrics(1500, "/mget"),
-		FwMatchMetrics: timer_metrics.NewTimerMetrics(1500, "/fwmatch"),
-		RangeMetrics:   timer_metrics.NewTimerMetrics(1500, "/range"),
+		GetMetrics:     newTimerMetrics(ctx.statsWindows),
+		MgetMetrics:    newTimerMetrics(ctx.statsWindows),
+		FwMatchMetrics: newTimerMetrics(ctx.statsWindows),
+		RangeMetrics:   newTimerMetrics(ctx.statsWindows),
 	}
-	if logging {
-		return LoggingHandler(os.Stdout, h)
+	for _, e := range s.endpointMetrics() {
+		e.timings.statsd = ctx.statsd
+		e.timings.statsdStat = e.name + ".request_time"
 	}
-	return h
+	return s
 }
 
 func (s *httpServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
@@ -67,10 +69,18 @@ func (s *httpServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		s.fwmatchHandler(w, req)
 	case "/range":
 		s.rangeHandler(w, req)
+	case "/schema":
+		s.schemaHandler(w, req)
 	case "/stats":
 		s.statsHandler(w, req)
+	case "/stats/reset":
+		s.statsResetHandler(w, req)
+	case "/metrics":
+		s.metricsHandler(w, req)
 	case "/reload":
 		s.reloadHandler(w, req)
+	case "/reload/status":
+		s.reloadStatusHandler(w, req)
 	// case "/exit":
 	// 	s.exitHandler(w, req)
 
@@ -102,66 +112,280 @@ func (s *httpServer) pingHandler(w http.ResponseWriter, req *http.Request) {
 	io.WriteString(w, "OK") // nolint:errcheck
 }
 
+// requestContext returns a context for a query that is canceled when the
+// client disconnects or the request timeout elapses
+func (s *httpServer) requestContext(req *http.Request) (context.Context, context.CancelFunc) {
+	if s.ctx.requestTimeout > 0 {
+		return context.WithTimeout(req.Context(), s.ctx.requestTimeout)
+	}
+	return context.WithCancel(req.Context())
+}
+
+// limits returns the bounds applied to query results
+func (s *httpServer) limits() sorteddb.Limits {
+	return sorteddb.Limits{MaxBytes: s.ctx.maxResponseBytes}
+}
+
+// dbError responds with a HTTP 503 when the DB is not available (eg: closed
+// or remapped mid request), a HTTP 504 when the request timed out, a HTTP 413
+// when the response would be too large and a HTTP 500 otherwise
+func dbError(w http.ResponseWriter, req *http.Request, err error) {
+	log.Printf("ERROR: %s %s", req.URL.Path, err)
+	switch err {
+	case sorteddb.ErrNotOpen, sorteddb.ErrClosed, sorteddb.ErrRemapped:
+		http.Error(w, "DB_UNAVAILABLE", 503)
+	case sorteddb.ErrLimitExceeded:
+		http.Error(w, "RESPONSE_TOO_LARGE", 413)
+	case context.DeadlineExceeded:
+		http.Error(w, "TIMEOUT", 504)
+	case context.Canceled:
+		// the client has gone away so there is no one to respond to
+	default:
+		http.Error(w, "INTERNAL_ERROR", 500)
+	}
+}
+
 func (s *httpServer) getHandler(w http.ResponseWriter, req *http.Request) {
 	key := req.FormValue("key")
 	if key == "" {
 		http.Error(w, "MISSING_ARG_KEY", 400)
 		return
 	}
+	enc, err := s.newEncoder(req)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	enc.valueOnly = true
 	startTime := time.Now()
 	atomic.AddUint64(&s.Requests, 1)
 	atomic.AddUint64(&s.GetRequests, 1)
+	defer s.GetMetrics.Status(startTime)
+	logQuery(req, 1, s.ctx.db.Generation())
+
+	ctx, cancel := s.requestContext(req)
+	defer cancel()
 
 	needle := []byte(key)
-	line := s.ctx.db.Search(needle)
+	if req.FormValue("all") == "1" {
+		s.getAll(ctx, w, req, needle, enc)
+		return
+	}
+	line, err := s.ctx.db.GetContext(ctx, needle)
+	if err != nil {
+		dbError(w, req, err)
+		return
+	}
 
 	if len(line) == 0 {
 		atomic.AddUint64(&s.GetMisses, 1)
 		http.Error(w, "NOT_FOUND", 404)
 	} else {
-		// we only output the 'value', so skip the needle and record separator
-		line = line[len(needle)+1:]
+		// we only output the 'value' (or selected fields), skipping the key
+		body := enc.appendValue(nil, line)
+		body = append(body, s.ctx.db.LineEnding)
 		atomic.AddUint64(&s.GetHits, 1)
-		w.Header().Set("Content-Type", "text/plain")
-		w.Header().Set("Content-Length", strconv.Itoa(len(line)+1))
-		w.Write(line)                        // nolint:errcheck
-		w.Write([]byte{s.ctx.db.LineEnding}) // nolint:errcheck
+		w.Header().Set("Content-Type", enc.contentType())
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.Write(body) // nolint:errcheck
+	}
+}
+
+// getAll writes the values (or selected fields) of all records matching needle
+func (s *httpServer) getAll(ctx context.Context, w http.ResponseWriter, req *http.Request, needle []byte, enc *recordEncoder) {
+	records, err := s.ctx.db.GetAllContext(ctx, needle, s.limits())
+	if err != nil {
+		dbError(w, req, err)
+		return
+	}
+	if len(records) == 0 {
+		atomic.AddUint64(&s.GetMisses, 1)
+		http.Error(w, "NOT_FOUND", 404)
+		return
+	}
+	atomic.AddUint64(&s.GetHits, 1)
+	var body []byte
+	for _, line := range records {
+		body = enc.appendRecord(body, needle, line)
 	}
-	s.GetMetrics.Status(startTime)
+	body = enc.appendEnd(body)
+	w.Header().Set("Content-Type", enc.contentType())
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.Write(body) // nolint:errcheck
 }
 
+// mgetBatchSize is the number of keys looked up together by /mget
+const mgetBatchSize = 1000
+
 func (s *httpServer) mgetHandler(w http.ResponseWriter, req *http.Request) {
-	err := req.ParseForm()
+	body, err := parseKeyArgs(req)
 	if err != nil {
 		http.Error(w, "BAD_REQUEST", 400)
 		return
 	}
-	if len(req.Form["key"]) == 0 {
+	if len(req.Form["key"]) == 0 && body == nil {
 		http.Error(w, "MISSING_ARG_KEY", 400)
 		return
 	}
+	enc, err := s.newEncoder(req)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	// text responses include the key in each line, JSON responses are keyed
+	enc.keyed = enc.format != formatText
+	enc.valueOnly = enc.keyed
 	startTime := time.Now()
 	atomic.AddUint64(&s.Requests, 1)
 	atomic.AddUint64(&s.MgetRequests, 1)
+	defer s.MgetMetrics.Status(startTime)
 
-	w.Header().Set("Content-Type", "text/plain")
-	var numFound int
-	for _, key := range req.Form["key"] {
-		needle := []byte(key)
-		line := s.ctx.db.Search(needle)
-		if len(line) != 0 {
-			numFound += 1
-			w.Write(line)                        // nolint:errcheck
-			w.Write([]byte{s.ctx.db.LineEnding}) // nolint:errcheck
+	ctx, cancel := s.requestContext(req)
+	defer cancel()
+
+	// with misses=1 every key is answered (in request order) including those
+	// not found
+	includeMisses := req.FormValue("misses") == "1"
+	// HTTP/1.x handlers can't continue reading the request body once the
+	// response has started, so responses to keys from a body are buffered
+	// (up to -max-buffered-response-bytes)
+	var out io.Writer = w
+	var buf *bytes.Buffer
+	maxBytes := s.ctx.maxResponseBytes
+	if body != nil {
+		buf = &bytes.Buffer{}
+		out = buf
+		if n := s.ctx.maxBufferedResponseBytes; n > 0 && (maxBytes == 0 || n < maxBytes) {
+			maxBytes = n
+		}
+	}
+	w.Header().Set("Content-Type", enc.contentType())
+	var size, numKeys int
+	var sent bool
+	var b []byte
+	var batch [][]byte
+	// keys already in a JSON response (which is bounded by its size)
+	seen := make(map[string]bool)
+	// keys are looked up in batches with GetMany, which searches them in
+	// sorted order to cut down on seeks
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
 		}
+		lines, err := s.ctx.db.GetManyContext(ctx, batch)
+		if err != nil {
+			return err
+		}
+		for i, needle := range batch {
+			// every requested key is counted, whichever the format
+			if len(lines[i]) != 0 {
+				atomic.AddUint64(&s.MgetHits, 1)
+			} else {
+				atomic.AddUint64(&s.MgetMisses, 1)
+			}
+			if enc.format == formatJSON && seen[string(needle)] {
+				// JSON object keys must be unique
+				continue
+			}
+			b = b[:0]
+			if len(lines[i]) != 0 {
+				b = enc.appendRecord(b, needle, lines[i])
+			} else if includeMisses {
+				b = enc.appendMiss(b, needle)
+			}
+			size += len(b)
+			if maxBytes > 0 && size > maxBytes {
+				return sorteddb.ErrLimitExceeded
+			}
+			if len(b) != 0 {
+				if enc.format == formatJSON {
+					seen[string(needle)] = true
+				}
+				sent = buf == nil
+				out.Write(b) // nolint:errcheck
+			}
+		}
+		batch = batch[:0]
+		return nil
+	}
+	err = forEachKey(req, body, func(key string) error {
+		numKeys++
+		batch = append(batch, []byte(key))
+		if len(batch) < mgetBatchSize {
+			return nil
+		}
+		return flush()
+	})
+	if err == nil {
+		err = flush()
+	}
+	logQuery(req, numKeys, s.ctx.db.Generation())
+	switch {
+	case err != nil && sent:
+		// part of the response has already been sent
+		log.Printf("ERROR: %s %s", req.URL.Path, err)
+		panic(http.ErrAbortHandler)
+	case err == errInvalidBody:
+		http.Error(w, err.Error(), 400)
+		return
+	case err != nil:
+		dbError(w, req, err)
+		return
+	case numKeys == 0:
+		http.Error(w, "MISSING_ARG_KEY", 400)
+		return
 	}
-	if numFound == 0 {
-		atomic.AddUint64(&s.MgetMisses, 1)
+	switch {
+	case enc.records != 0:
+		out.Write(enc.appendEnd(nil)) // nolint:errcheck
+	case enc.format == formatJSON:
+		io.WriteString(out, "{}\n") // nolint:errcheck
+	}
+	if buf != nil {
+		w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+		w.Write(buf.Bytes()) // nolint:errcheck
+	} else if enc.records == 0 && enc.format != formatJSON {
 		w.WriteHeader(200)
-	} else {
-		atomic.AddUint64(&s.MgetHits, 1)
 	}
-	s.MgetMetrics.Status(startTime)
+}
+
+// streamRecords sends the records written by write (eg: directly from the
+// mapping) as the response. net/http sends small responses with a
+// Content-Length and uses chunked transfer encoding for larger ones. If write
+// fails after part of the response has been sent the connection is aborted.
+func (s *httpServer) streamRecords(w http.ResponseWriter, contentType string, write func(io.Writer) (int64, error)) (int64, error) {
+	w.Header().Set("Content-Type", contentType)
+	n, err := write(w)
+	if err != nil && n > 0 {
+		log.Printf("ERROR: streaming response %s", err)
+		panic(http.ErrAbortHandler)
+	}
+	return n, err
+}
+
+// sendRecords responds with the records from it (see encodeRecords).
+// Unpaged responses are streamed unless they are bounded by a maximum
+// response size, in which case they are buffered so that exceeding it can be
+// reported with a HTTP 413.
+func (s *httpServer) sendRecords(ctx context.Context, w http.ResponseWriter, it *sorteddb.Iterator, inRange func(key []byte) bool, p pagination, enc *recordEncoder) (int64, error) {
+	if !p.paged() && s.ctx.maxResponseBytes == 0 {
+		return s.streamRecords(w, enc.contentType(), func(w io.Writer) (int64, error) {
+			n, _, err := s.encodeRecords(ctx, w, it, inRange, p, enc)
+			return n, err
+		})
+	}
+	var buf bytes.Buffer
+	n, token, err := s.encodeRecords(ctx, &buf, it, inRange, p, enc)
+	if err != nil || n == 0 {
+		return 0, err
+	}
+	if token != "" {
+		w.Header().Set("X-Continuation-Token", token)
+	}
+	w.Header().Set("Content-Type", enc.contentType())
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.Write(buf.Bytes()) // nolint:errcheck
+	return n, nil
 }
 
 func (s *httpServer) fwmatchHandler(w http.ResponseWriter, req *http.Request) {
@@ -170,23 +394,67 @@ func (s *httpServer) fwmatchHandler(w http.ResponseWriter, req *http.Request) {
 		http.Error(w, "MISSING_ARG_KEY", 400)
 		return
 	}
+	p, err := parsePagination(req, queryHash("fwmatch", key))
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	enc, err := s.newEncoder(req)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
 	startTime := time.Now()
 	atomic.AddUint64(&s.Requests, 1)
 	atomic.AddUint64(&s.FwMatchRequests, 1)
+	defer s.FwMatchMetrics.Status(startTime)
+	logQuery(req, 1, s.ctx.db.Generation())
+
+	ctx, cancel := s.requestContext(req)
+	defer cancel()
 
 	needle := []byte(key)
-	content := s.ctx.db.ForwardMatch(needle)
+	var it *sorteddb.Iterator
+	switch {
+	case p.token != nil:
+		var code int
+		it, code, err = s.resume(p.token)
+		if err != nil {
+			http.Error(w, err.Error(), code)
+			return
+		}
+	case p.desc:
+		it = s.ctx.db.SeekReversePrefix(needle)
+	case p.paged() || !enc.raw():
+		it = s.ctx.db.Seek(needle)
+	}
 
-	if len(content) == 0 {
+	if it == nil {
+		n, err := s.streamRecords(w, "text/plain", func(w io.Writer) (int64, error) {
+			return s.ctx.db.WritePrefixTo(ctx, w, needle, s.limits())
+		})
+		if err != nil {
+			dbError(w, req, err)
+		} else if n == 0 {
+			atomic.AddUint64(&s.FwMatchMisses, 1)
+			http.Error(w, "NOT_FOUND", 404)
+		} else {
+			atomic.AddUint64(&s.FwMatchHits, 1)
+		}
+		return
+	}
+
+	n, err := s.sendRecords(ctx, w, it, func(k []byte) bool {
+		return s.ctx.db.HasPrefix(k, needle)
+	}, p, enc)
+	if err != nil {
+		dbError(w, req, err)
+	} else if n == 0 {
 		atomic.AddUint64(&s.FwMatchMisses, 1)
 		http.Error(w, "NOT_FOUND", 404)
 	} else {
 		atomic.AddUint64(&s.FwMatchHits, 1)
-		w.Header().Set("Content-Type", "text/plain")
-		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
-		w.Write(content) // nolint:errcheck
 	}
-	s.FwMatchMetrics.Status(startTime)
 }
 
 func (s *httpServer) rangeHandler(w http.ResponseWriter, req *http.Request) {
@@ -200,106 +468,234 @@ func (s *httpServer) rangeHandler(w http.ResponseWriter, req *http.Request) {
 		http.Error(w, "MISSING_ARG_END", 400)
 		return
 	}
-	if endKey < startKey {
+	if s.ctx.db.Compare([]byte(endKey), []byte(startKey)) < 0 {
 		http.Error(w, "MALFORMED_RANGE", 400)
 		return
 	}
+	p, err := parsePagination(req, queryHash("range", startKey, endKey))
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	enc, err := s.newEncoder(req)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
 	startTime := time.Now()
 	atomic.AddUint64(&s.Requests, 1)
 	atomic.AddUint64(&s.RangeRequests, 1)
+	defer s.RangeMetrics.Status(startTime)
+	logQuery(req, 1, s.ctx.db.Generation())
+
+	ctx, cancel := s.requestContext(req)
+	defer cancel()
 
 	startNeedle := []byte(startKey)
 	endNeedle := []byte(endKey)
-	content := s.ctx.db.RangeMatch(startNeedle, endNeedle)
+	var it *sorteddb.Iterator
+	switch {
+	case p.token != nil:
+		var code int
+		it, code, err = s.resume(p.token)
+		if err != nil {
+			http.Error(w, err.Error(), code)
+			return
+		}
+	case p.desc:
+		it = s.ctx.db.SeekReverse(endNeedle)
+	case p.paged() || !enc.raw():
+		it = s.ctx.db.Seek(startNeedle)
+	}
+
+	if it == nil {
+		n, err := s.streamRecords(w, "text/plain", func(w io.Writer) (int64, error) {
+			return s.ctx.db.WriteRangeTo(ctx, w, startNeedle, endNeedle, s.limits())
+		})
+		if err != nil {
+			dbError(w, req, err)
+		} else if n == 0 {
+			atomic.AddUint64(&s.RangeMisses, 1)
+			http.Error(w, "NOT_FOUND", 404)
+		} else {
+			atomic.AddUint64(&s.RangeHits, 1)
+		}
+		return
+	}
 
-	if len(content) == 0 {
+	// both bounds are checked as a token may resume from anywhere
+	n, err := s.sendRecords(ctx, w, it, func(k []byte) bool {
+		return s.ctx.db.Compare(k, startNeedle) >= 0 && s.ctx.db.Compare(k, endNeedle) <= 0
+	}, p, enc)
+	if err != nil {
+		dbError(w, req, err)
+	} else if n == 0 {
 		atomic.AddUint64(&s.RangeMisses, 1)
 		http.Error(w, "NOT_FOUND", 404)
 	} else {
 		atomic.AddUint64(&s.RangeHits, 1)
-		w.Header().Set("Content-Type", "text/plain")
-		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
-		w.Write(content) // nolint:errcheck
 	}
-	s.RangeMetrics.Status(startTime)
 }
 
 func (s *httpServer) reloadHandler(w http.ResponseWriter, req *http.Request) {
-	s.ctx.reloadChan <- 1
+	err := s.ctx.Reload()
+	if err != nil {
+		http.Error(w, "RELOAD_FAILED: "+err.Error(), 500)
+		return
+	}
 	w.Header().Set("Content-Length", "2")
 	io.WriteString(w, "OK") // nolint:errcheck
 }
 
+func (s *httpServer) reloadStatusHandler(w http.ResponseWriter, req *http.Request) {
+	response, err := json.Marshal(s.ctx.ReloadStatus())
+	if err != nil {
+		log.Printf("%s", err)
+		http.Error(w, "INTERNAL_ERROR", 500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Content-Length", strconv.Itoa(len(response)))
+	w.WriteHeader(200)
+	w.Write(response) // nolint:errcheck
+}
+
 type statsResponse struct {
 	Requests        uint64        `json:"total_requests"`
 	SeekCount       uint64        `json:"total_seeks"`
+	BloomSkips      uint64        `json:"bloom_skips"`
 	GetRequests     uint64        `json:"get_requests"`
 	GetHits         uint64        `json:"get_hits"`
 	GetMisses       uint64        `json:"get_misses"`
 	GetAvg          time.Duration `json:"get_average_request"` // Microsecond
 	Get95           time.Duration `json:"get_95"`              // Microsecond
 	Get99           time.Duration `json:"get_99"`              // Microsecond
+	Get999          time.Duration `json:"get_999"`             // Microsecond
+	GetMax          time.Duration `json:"get_max"`             // Microsecond
 	MgetRequests    uint64        `json:"mget_requests"`
 	MgetHits        uint64        `json:"mget_hits"`
 	MgetMisses      uint64        `json:"mget_misses"`
 	MgetAvg         time.Duration `json:"mget_average_request"` // Microsecond
 	Mget95          time.Duration `json:"mget_95"`              // Microsecond
 	Mget99          time.Duration `json:"mget_99"`              // Microsecond
+	Mget999         time.Duration `json:"mget_999"`             // Microsecond
+	MgetMax         time.Duration `json:"mget_max"`             // Microsecond
 	FwMatchRequests uint64        `json:"fwmatch_requests"`
 	FwMatchHits     uint64        `json:"fwmatch_hits"`
 	FwMatchMisses   uint64        `json:"fwmatch_misses"`
 	FwMatchAvg      time.Duration `json:"fwmatch_average_request"` // Microsecond
 	FwMatch95       time.Duration `json:"fwmatch_95"`              // Microsecond
 	FwMatch99       time.Duration `json:"fwmatch_99"`              // Microsecond
+	FwMatch999      time.Duration `json:"fwmatch_999"`             // Microsecond
+	FwMatchMax      time.Duration `json:"fwmatch_max"`             // Microsecond
 	RangeRequests   uint64        `json:"range_requests"`
 	RangeHits       uint64        `json:"range_hits"`
 	RangeMisses     uint64        `json:"range_misses"`
 	RangeAvg        time.Duration `json:"range_average_request"` // Microsecond
 	Range95         time.Duration `json:"range_95"`              // Microsecond
 	Range99         time.Duration `json:"range_99"`              // Microsecond
+	Range999        time.Duration `json:"range_999"`             // Microsecond
+	RangeMax        time.Duration `json:"range_max"`             // Microsecond
 	DBSize          int64         `json:"db_size"`
 	DBMtime         int64         `json:"db_mtime"`
+	IndexEntries    int           `json:"index_entries"`
+	IndexBytes      int           `json:"index_bytes"`
+	IndexBuildTime  time.Duration `json:"index_build_time"` // Microsecond
+	QuotedRecords   int           `json:"record_table_records"`
+	QuotedBytes     int           `json:"record_table_bytes"`
+	QuotedBuildTime time.Duration `json:"record_table_build_time"` // Microsecond
+	Reloads         uint64        `json:"reloads"`
+	ReloadFailures  uint64        `json:"reload_failures"`
+	LastReloadError string        `json:"last_reload_error"`
+
+	// Timings has the request durations of each endpoint in each window
+	Timings map[string]map[string]timingStats `json:"timings"`
 }
 
-func (s *httpServer) statsHandler(w http.ResponseWriter, req *http.Request) {
-	getStats := s.GetMetrics.Stats()
-	mgetStats := s.MgetMetrics.Stats()
-	fwMatchStats := s.FwMatchMetrics.Stats()
-	rangeStats := s.RangeMetrics.Stats()
+// stats returns the current counters and request timings. The per endpoint
+// timings are for the shortest stats window.
+func (s *httpServer) stats() statsResponse {
+	var window time.Duration
+	if len(s.ctx.statsWindows) > 0 {
+		window = s.ctx.statsWindows[0].duration
+	}
+	getStats := s.GetMetrics.Window(window)
+	mgetStats := s.MgetMetrics.Window(window)
+	fwMatchStats := s.FwMatchMetrics.Window(window)
+	rangeStats := s.RangeMetrics.Window(window)
 	size, mtime := s.ctx.db.Info()
-	stats := statsResponse{
+	indexStats := s.ctx.db.IndexStats()
+	recordTableStats := s.ctx.db.RecordTableStats()
+	reloadStatus := s.ctx.ReloadStatus()
+	// evbuffer_add_printf(evb, "\"total_seeks\": %"PRIu64",", total_seeks);
+	return statsResponse{
 		Requests:        atomic.LoadUint64(&s.Requests),
 		SeekCount:       s.ctx.db.SeekCount(),
+		BloomSkips:      s.ctx.db.BloomSkips(),
 		GetRequests:     atomic.LoadUint64(&s.GetRequests),
 		GetHits:         atomic.LoadUint64(&s.GetHits),
 		GetMisses:       atomic.LoadUint64(&s.GetMisses),
-		GetAvg:          getStats.Avg / time.Microsecond,
-		Get95:           getStats.P95 / time.Microsecond,
-		Get99:           getStats.P99 / time.Microsecond,
+		GetAvg:          getStats.Avg() / time.Microsecond,
+		Get95:           getStats.Percentile(95) / time.Microsecond,
+		Get99:           getStats.Percentile(99) / time.Microsecond,
+		Get999:          getStats.Percentile(99.9) / time.Microsecond,
+		GetMax:          getStats.max / time.Microsecond,
 		MgetRequests:    atomic.LoadUint64(&s.MgetRequests),
 		MgetHits:        atomic.LoadUint64(&s.MgetHits),
 		MgetMisses:      atomic.LoadUint64(&s.MgetMisses),
-		MgetAvg:         mgetStats.Avg / time.Microsecond,
-		Mget95:          mgetStats.P95 / time.Microsecond,
-		Mget99:          mgetStats.P99 / time.Microsecond,
+		MgetAvg:         mgetStats.Avg() / time.Microsecond,
+		Mget95:          mgetStats.Percentile(95) / time.Microsecond,
+		Mget99:          mgetStats.Percentile(99) / time.Microsecond,
+		Mget999:         mgetStats.Percentile(99.9) / time.Microsecond,
+		MgetMax:         mgetStats.max / time.Microsecond,
 		FwMatchRequests: atomic.LoadUint64(&s.FwMatchRequests),
 		FwMatchHits:     atomic.LoadUint64(&s.FwMatchHits),
 		FwMatchMisses:   atomic.LoadUint64(&s.FwMatchMisses),
-		FwMatchAvg:      fwMatchStats.Avg / time.Microsecond,
-		FwMatch95:       fwMatchStats.P95 / time.Microsecond,
-		FwMatch99:       fwMatchStats.P99 / time.Microsecond,
+		FwMatchAvg:      fwMatchStats.Avg() / time.Microsecond,
+		FwMatch95:       fwMatchStats.Percentile(95) / time.Microsecond,
+		FwMatch99:       fwMatchStats.Percentile(99) / time.Microsecond,
+		FwMatch999:      fwMatchStats.Percentile(99.9) / time.Microsecond,
+		FwMatchMax:      fwMatchStats.max / time.Microsecond,
 		RangeRequests:   atomic.LoadUint64(&s.RangeRequests),
 		RangeHits:       atomic.LoadUint64(&s.RangeHits),
 		RangeMisses:     atomic.LoadUint64(&s.RangeMisses),
-		RangeAvg:        rangeStats.Avg / time.Microsecond,
-		Range95:         rangeStats.P95 / time.Microsecond,
-		Range99:         rangeStats.P99 / time.Microsecond,
+		RangeAvg:        rangeStats.Avg() / time.Microsecond,
+		Range95:         rangeStats.Percentile(95) / time.Microsecond,
+		Range99:         rangeStats.Percentile(99) / time.Microsecond,
+		Range999:        rangeStats.Percentile(99.9) / time.Microsecond,
+		RangeMax:        rangeStats.max / time.Microsecond,
 		DBSize:          int64(size),
 		DBMtime:         mtime.Unix(),
+		IndexEntries:    indexStats.Entries,
+		IndexBytes:      indexStats.Bytes,
+		IndexBuildTime:  indexStats.BuildTime / time.Microsecond,
+		QuotedRecords:   recordTableStats.Records,
+		QuotedBytes:     recordTableStats.Bytes,
+		QuotedBuildTime: recordTableStats.BuildTime / time.Microsecond,
+		Reloads:         reloadStatus.Reloads,
+		ReloadFailures:  reloadStatus.Failures,
+		LastReloadError: reloadStatus.LastError,
+		Timings:         s.timings(),
 	}
-	// evbuffer_add_printf(evb, "\"total_seeks\": %"PRIu64",", total_seeks);
+}
+
+// timings summarizes the request durations of each endpoint in each stats
+// window with the configured percentiles
+func (s *httpServer) timings() map[string]map[string]timingStats {
+	timings := make(map[string]map[string]timingStats)
+	for _, e := range s.endpointMetrics() {
+		windows := make(map[string]timingStats)
+		for _, w := range s.ctx.statsWindows {
+			windows[w.name] = newTimingStats(e.timings.Window(w.duration), s.ctx.statsPercentiles)
+		}
+		timings[e.name] = windows
+	}
+	return timings
+}
 
-	response, err := json.Marshal(stats)
+func (s *httpServer) statsHandler(w http.ResponseWriter, req *http.Request) {
+	response, err := json.Marshal(s.stats())
 	if err != nil {
 		log.Printf("%s", err)
 		http.Error(w, "INTERNAL_ERROR", 500)
@@ -312,3 +708,12 @@ func (s *httpServer) statsHandler(w http.ResponseWriter, req *http.Request) {
 	w.Write(response) // nolint:errcheck
 
 }
+
+// statsResetHandler discards the request timings (the counters are unchanged)
+func (s *httpServer) statsResetHandler(w http.ResponseWriter, req *http.Request) {
+	for _, e := range s.endpointMetrics() {
+		e.timings.Reset()
+	}
+	w.Header().Set("Content-Length", "2")
+	io.WriteString(w, "OK") // nolint:errcheck
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestTimingsRecordedOnError(t *testing.T) {
+	s, cleanup := newTestServer(t, "a\t1\nb\t2\n")
+	defer cleanup()
+	s.ctx.db.Close()
+
+	for _, tc := range []struct {
+		url     string
+		timings *timerMetrics
+	}{
+		{"/get?key=a", s.GetMetrics},
+		{"/mget?key=a&key=b", s.MgetMetrics},
+		{"/fwmatch?key=a", s.FwMatchMetrics},
+		{"/range?start=a&end=b", s.RangeMetrics},
+	} {
+		if code, body, _ := get(s, tc.url); code != 503 {
+			t.Errorf("%s got %d %q expected 503", tc.url, code, body)
+		}
+		if got := tc.timings.Lifetime().count; got != 1 {
+			t.Errorf("%s got %d timings expected 1", tc.url, got)
+		}
+	}
+}
+
+func TestMgetStatsMatchAcrossFormats(t *testing.T) {
+	for _, format := range []string{"text", "json", "ndjson"} {
+		s, cleanup := newTestServer(t, "a\t1\nb\t2\n")
+		// duplicate keys are only answered once in JSON but are counted in each format
+		if code, body, _ := get(s, "/mget?key=a&key=a&key=c&key=c&key=b&format="+format); code != 200 {
+			t.Errorf("%s got %d %q", format, code, body)
+		}
+		if s.MgetHits != 3 || s.MgetMisses != 2 {
+			t.Errorf("%s got %d hits %d misses expected 3 hits 2 misses", format, s.MgetHits, s.MgetMisses)
+		}
+		cleanup()
+	}
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/jehiah/sortdb/src/lib/sorteddb"
+)
+
+// keyOrders maps -key-order values to the matching sort(1) ordering
+var keyOrders = map[string]sorteddb.Comparator{
+	"bytes":    sorteddb.ByteOrder,     // LC_COLLATE=C sort
+	"numeric":  sorteddb.NumericOrder,  // sort -n
+	"float":    sorteddb.FloatOrder,    // sort -g
+	"casefold": sorteddb.CaseFoldOrder, // sort -f
+	"version":  sorteddb.VersionOrder,  // sort -V
+}
+
+const keyOrderUsage = "order keys are sorted in: bytes, numeric (sort -n), float (sort -g), casefold (sort -f) or version (sort -V)"
+
+func parseKeyOrder(name string) (sorteddb.Comparator, error) {
+	c, ok := keyOrders[name]
+	if !ok {
+		return nil, fmt.Errorf("invalid key order %q", name)
+	}
+	return c, nil
+}
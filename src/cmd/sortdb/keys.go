@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+var errInvalidBody = errors.New("INVALID_BODY")
+
+// maxFormBytes matches the limit net/http applies to form encoded bodies
+const maxFormBytes = 10 << 20
+
+// parseKeyArgs parses the arguments of req (as with ParseForm) and returns
+// its POST body of keys, or nil if there isn't one. A form encoded body
+// without any key arguments is taken to be newline delimited keys, as that is
+// how curl --data-binary sends a file by default.
+func parseKeyArgs(req *http.Request) (io.Reader, error) {
+	if !hasBody(req) || contentType(req) != "application/x-www-form-urlencoded" {
+		err := req.ParseForm()
+		if err != nil || !hasKeyBody(req) {
+			return nil, err
+		}
+		return req.Body, nil
+	}
+	b, err := io.ReadAll(io.LimitReader(req.Body, maxFormBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	var body io.Reader
+	if values, err := url.ParseQuery(string(b)); len(b) > maxFormBytes || err != nil || len(values["key"]) == 0 {
+		// the rest of a body too large to be a form is read incrementally
+		body = io.MultiReader(bytes.NewReader(b), req.Body)
+		req.Body = http.NoBody
+	} else {
+		req.Body = io.NopCloser(bytes.NewReader(b))
+	}
+	if err := req.ParseForm(); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// forEachKey calls fn with each key argument of req and then each key in
+// body (as returned by parseKeyArgs) of newline delimited keys (or a JSON
+// array of keys when the Content-Type is application/json). The body is read
+// incrementally so that large batches are never held in memory at once.
+// Iteration stops at the first error returned by fn, which is returned.
+func forEachKey(req *http.Request, body io.Reader, fn func(key string) error) error {
+	for _, key := range req.Form["key"] {
+		if err := fn(key); err != nil {
+			return err
+		}
+	}
+	if body == nil {
+		return nil
+	}
+	if contentType(req) == "application/json" {
+		return forEachJSONKey(body, fn)
+	}
+	r := bufio.NewReader(body)
+	for {
+		line, err := r.ReadString('\n')
+		if key := strings.TrimRight(line, "\r\n"); key != "" {
+			if err := fn(key); err != nil {
+				return err
+			}
+		}
+		switch err {
+		case nil:
+		case io.EOF:
+			return nil
+		default:
+			return err
+		}
+	}
+}
+
+// hasKeyBody returns true for a POST with a body of keys (other than form
+// values which are parsed into req.Form)
+func hasKeyBody(req *http.Request) bool {
+	if !hasBody(req) {
+		return false
+	}
+	switch contentType(req) {
+	case "application/x-www-form-urlencoded", "multipart/form-data":
+		return false
+	}
+	return true
+}
+
+func hasBody(req *http.Request) bool {
+	return req.Method == "POST" && req.Body != nil && req.Body != http.NoBody
+}
+
+func contentType(req *http.Request) string {
+	mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type")) // nolint:errcheck
+	return mediaType
+}
+
+// forEachJSONKey calls fn with each string in a JSON array read from r
+func forEachJSONKey(r io.Reader, fn func(key string) error) error {
+	d := json.NewDecoder(r)
+	if t, err := d.Token(); err != nil || t != json.Delim('[') {
+		return errInvalidBody
+	}
+	for d.More() {
+		var key string
+		if err := d.Decode(&key); err != nil {
+			return errInvalidBody
+		}
+		if err := fn(key); err != nil {
+			return err
+		}
+	}
+	if t, err := d.Token(); err != nil || t != json.Delim(']') {
+		return errInvalidBody
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestForEachKey(t *testing.T) {
+	for _, tc := range []struct {
+		name, url, contentType, body string
+		expected                     []string
+	}{
+		{"query", "/mget?key=a&key=b", "", "", []string{"a", "b"}},
+		{"text body", "/mget?key=a", "text/plain", "b\nc\r\n\nd", []string{"a", "b", "c", "d"}},
+		{"json body", "/mget", "application/json", `["a","b\n"]`, []string{"a", "b\n"}},
+		{"form", "/mget?key=a", "application/x-www-form-urlencoded", "key=b&key=c+d", []string{"b", "c d", "a"}},
+		{"form encoded keys", "/mget?misses=1", "application/x-www-form-urlencoded", "a+b\nc%20d\n", []string{"a+b", "c%20d"}},
+	} {
+		req := httptest.NewRequest("POST", tc.url, strings.NewReader(tc.body))
+		if tc.contentType != "" {
+			req.Header.Set("Content-Type", tc.contentType)
+		}
+		body, err := parseKeyArgs(req)
+		if err != nil {
+			t.Fatalf("%s: got error %s", tc.name, err)
+		}
+		var keys []string
+		err = forEachKey(req, body, func(key string) error {
+			keys = append(keys, key)
+			return nil
+		})
+		if err != nil {
+			t.Errorf("%s: got error %s", tc.name, err)
+		}
+		if strings.Join(keys, ",") != strings.Join(tc.expected, ",") {
+			t.Errorf("%s: got keys %q expected %q", tc.name, keys, tc.expected)
+		}
+	}
+}
@@ -6,6 +6,7 @@ package main
 import (
 	"fmt"
 	"io"
+	"math/rand"
 	"net"
 	"net/http"
 	"net/url"
@@ -51,18 +52,47 @@ func (l *responseLogger) Size() int {
 type loggingHandler struct {
 	writer  io.Writer
 	handler http.Handler
+	options logOptions
 }
 
-func LoggingHandler(out io.Writer, h http.Handler) http.Handler {
-	return loggingHandler{out, h}
+func LoggingHandler(out io.Writer, h http.Handler, options logOptions) http.Handler {
+	return loggingHandler{out, h, options}
 }
 
 func (h loggingHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	t := time.Now()
 	logger := &responseLogger{w: w}
 	url := *req.URL
+	req, info := withRequestInfo(req)
+	defer func() {
+		if p := recover(); p != nil {
+			// the response was aborted part way through (eg: with
+			// http.ErrAbortHandler); log it before net/http closes the
+			// connection
+			info.aborted = true
+			h.log(req, url, t, logger, info)
+			panic(p)
+		}
+	}()
 	h.handler.ServeHTTP(logger, req)
-	logLine := buildLogLine(req, url, t, logger.Status(), logger.Size())
+	h.log(req, url, t, logger, info)
+}
+
+// log writes the access log line for a request (subject to the sample rate
+// and slow threshold)
+func (h loggingHandler) log(req *http.Request, url url.URL, t time.Time, logger *responseLogger, info *requestInfo) {
+	if time.Since(t) < h.options.slowThreshold {
+		return
+	}
+	if h.options.sampleRate < 1 && rand.Float64() >= h.options.sampleRate {
+		return
+	}
+	var logLine []byte
+	if h.options.format == "json" {
+		logLine = buildJSONLogLine(req, url, t, logger.Status(), logger.Size(), info)
+	} else {
+		logLine = buildLogLine(req, url, t, logger.Status(), logger.Size())
+	}
 	h.writer.Write(logLine) // nolint:errcheck
 }
 
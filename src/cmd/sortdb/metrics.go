@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// latencyBuckets are the upper bounds (in seconds) of the request duration
+// histograms exposed on /metrics. They cover all requests since startup (and
+// are not cleared by /stats/reset) so they only ever increase as Prometheus
+// expects.
+var latencyBuckets = []float64{.0001, .00025, .0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// metricsWriter formats metrics in the Prometheus text exposition format
+type metricsWriter struct {
+	bytes.Buffer
+}
+
+func (m *metricsWriter) header(name, kind, help string) {
+	fmt.Fprintf(m, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func (m *metricsWriter) value(name, labels string, v float64) {
+	if labels != "" {
+		labels = "{" + labels + "}"
+	}
+	fmt.Fprintf(m, "%s%s %s\n", name, labels, strconv.FormatFloat(v, 'f', -1, 64))
+}
+
+// histogram writes the durations recorded in h as cumulative latencyBuckets
+func (m *metricsWriter) histogram(name, labels string, h *histogram) {
+	for _, le := range latencyBuckets {
+		count := h.CountBelow(time.Duration(le * float64(time.Second)))
+		m.value(name+"_bucket", labels+`,le="`+strconv.FormatFloat(le, 'f', -1, 64)+`"`, float64(count))
+	}
+	m.value(name+"_bucket", labels+`,le="+Inf"`, float64(h.count))
+	m.value(name+"_sum", labels, h.sum.Seconds())
+	m.value(name+"_count", labels, float64(h.count))
+}
+
+// endpointMetrics are the counters kept for each query endpoint
+type endpointMetrics struct {
+	name     string
+	requests *uint64
+	hits     *uint64
+	misses   *uint64
+	timings  *timerMetrics
+}
+
+func (s *httpServer) endpointMetrics() []endpointMetrics {
+	return []endpointMetrics{
+		{"get", &s.GetRequests, &s.GetHits, &s.GetMisses, s.GetMetrics},
+		{"mget", &s.MgetRequests, &s.MgetHits, &s.MgetMisses, s.MgetMetrics},
+		{"fwmatch", &s.FwMatchRequests, &s.FwMatchHits, &s.FwMatchMisses, s.FwMatchMetrics},
+		{"range", &s.RangeRequests, &s.RangeHits, &s.RangeMisses, s.RangeMetrics},
+	}
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func (s *httpServer) metricsHandler(w http.ResponseWriter, req *http.Request) {
+	endpoints := s.endpointMetrics()
+	size, mtime := s.ctx.db.Info()
+	indexStats := s.ctx.db.IndexStats()
+	reloadStatus := s.ctx.ReloadStatus()
+
+	var m metricsWriter
+	m.header("sortdb_requests_total", "counter", "Query requests by endpoint.")
+	for _, e := range endpoints {
+		m.value("sortdb_requests_total", `endpoint="`+e.name+`"`, float64(atomic.LoadUint64(e.requests)))
+	}
+	m.header("sortdb_hits_total", "counter", "Query hits by endpoint (per key for mget).")
+	for _, e := range endpoints {
+		m.value("sortdb_hits_total", `endpoint="`+e.name+`"`, float64(atomic.LoadUint64(e.hits)))
+	}
+	m.header("sortdb_misses_total", "counter", "Query misses by endpoint (per key for mget).")
+	for _, e := range endpoints {
+		m.value("sortdb_misses_total", `endpoint="`+e.name+`"`, float64(atomic.LoadUint64(e.misses)))
+	}
+	m.header("sortdb_request_duration_seconds", "histogram", "Query request duration by endpoint.")
+	for _, e := range endpoints {
+		m.histogram("sortdb_request_duration_seconds", `endpoint="`+e.name+`"`, e.timings.Lifetime())
+	}
+	m.header("sortdb_seeks_total", "counter", "Seeks into the db file.")
+	m.value("sortdb_seeks_total", "", float64(s.ctx.db.SeekCount()))
+	m.header("sortdb_bloom_skips_total", "counter", "Lookups answered by the bloom filter without seeking.")
+	m.value("sortdb_bloom_skips_total", "", float64(s.ctx.db.BloomSkips()))
+	m.header("sortdb_db_size_bytes", "gauge", "Size of the mapped db file.")
+	m.value("sortdb_db_size_bytes", "", float64(size))
+	m.header("sortdb_db_mtime_seconds", "gauge", "Modification time of the mapped db file.")
+	m.value("sortdb_db_mtime_seconds", "", float64(mtime.Unix()))
+	m.header("sortdb_db_generation", "gauge", "Number of times the db file has been mapped.")
+	m.value("sortdb_db_generation", "", float64(s.ctx.db.Generation()))
+	m.header("sortdb_db_mlocked", "gauge", "Whether the mapped db file is locked in memory.")
+	m.value("sortdb_db_mlocked", "", boolValue(s.ctx.db.Mlocked()))
+	m.header("sortdb_index_entries", "gauge", "Entries in the sparse index.")
+	m.value("sortdb_index_entries", "", float64(indexStats.Entries))
+	m.header("sortdb_reloads_total", "counter", "Successful reloads of the db file.")
+	m.value("sortdb_reloads_total", "", float64(reloadStatus.Reloads))
+	m.header("sortdb_reload_failures_total", "counter", "Failed reloads of the db file.")
+	m.value("sortdb_reload_failures_total", "", float64(reloadStatus.Failures))
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Header().Set("Content-Length", strconv.Itoa(m.Len()))
+	w.WriteHeader(200)
+	w.Write(m.Bytes()) // nolint:errcheck
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/jehiah/sortdb/src/lib/sorteddb"
+)
+
+var (
+	errInvalidOrder  = errors.New("INVALID_ARG_ORDER")
+	errInvalidLimit  = errors.New("INVALID_ARG_LIMIT")
+	errInvalidOffset = errors.New("INVALID_ARG_OFFSET")
+	errInvalidToken  = errors.New("INVALID_TOKEN")
+)
+
+// continuationToken identifies where a paged /range or /fwmatch request
+// should resume. It is only valid against the DB generation and the query it
+// was issued for.
+type continuationToken struct {
+	generation uint64
+	offset     int
+	desc       bool
+	query      uint32 // see queryHash
+}
+
+// queryHash identifies the endpoint and keys of a query so that a token can
+// not be used to resume a different one
+func queryHash(endpoint string, keys ...string) uint32 {
+	h := fnv.New32a()
+	io.WriteString(h, endpoint) // nolint:errcheck
+	for _, k := range keys {
+		h.Write([]byte{0})   // nolint:errcheck
+		io.WriteString(h, k) // nolint:errcheck
+	}
+	return h.Sum32()
+}
+
+func (t continuationToken) String() string {
+	order := "asc"
+	if t.desc {
+		order = "desc"
+	}
+	s := fmt.Sprintf("%d:%d:%x:%s", t.generation, t.offset, t.query, order)
+	return base64.RawURLEncoding.EncodeToString([]byte(s))
+}
+
+func parseContinuationToken(s string) (*continuationToken, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errInvalidToken
+	}
+	var t continuationToken
+	var order string
+	_, err = fmt.Sscanf(string(b), "%d:%d:%x:%s", &t.generation, &t.offset, &t.query, &order)
+	if err != nil || t.offset < 0 {
+		return nil, errInvalidToken
+	}
+	switch order {
+	case "asc":
+	case "desc":
+		t.desc = true
+	default:
+		return nil, errInvalidToken
+	}
+	return &t, nil
+}
+
+// pagination holds the order, limit, offset and token arguments of a request
+type pagination struct {
+	desc   bool
+	limit  int // 0 for unlimited
+	offset int // number of records to skip
+	token  *continuationToken
+	query  uint32 // see queryHash
+}
+
+func (p pagination) paged() bool {
+	return p.limit > 0 || p.offset > 0 || p.token != nil
+}
+
+// parsePagination parses the pagination arguments of a request for query
+// (see queryHash). The offset only applies to the first page, so it is
+// ignored when resuming from a token.
+func parsePagination(req *http.Request, query uint32) (p pagination, err error) {
+	p.query = query
+	switch req.FormValue("order") {
+	case "", "asc":
+	case "desc":
+		p.desc = true
+	default:
+		return p, errInvalidOrder
+	}
+	if v := req.FormValue("limit"); v != "" {
+		p.limit, err = strconv.Atoi(v)
+		if err != nil || p.limit < 0 {
+			return p, errInvalidLimit
+		}
+	}
+	if v := req.FormValue("offset"); v != "" {
+		p.offset, err = strconv.Atoi(v)
+		if err != nil || p.offset < 0 {
+			return p, errInvalidOffset
+		}
+	}
+	if v := req.FormValue("token"); v != "" {
+		p.token, err = parseContinuationToken(v)
+		if err != nil {
+			return p, err
+		}
+		if p.token.desc != p.desc || p.token.query != p.query {
+			return p, errInvalidToken
+		}
+		p.offset = 0
+	}
+	return p, nil
+}
+
+// resume returns an iterator positioned at the continuation token
+func (s *httpServer) resume(t *continuationToken) (*sorteddb.Iterator, int, error) {
+	it, err := s.ctx.db.SeekOffset(t.generation, t.offset, t.desc)
+	switch err {
+	case nil:
+		return it, 200, nil
+	case sorteddb.ErrRemapped:
+		return nil, 409, errors.New("STALE_TOKEN")
+	case sorteddb.ErrInvalidOffset:
+		return nil, 400, errInvalidToken
+	case sorteddb.ErrNotOpen, sorteddb.ErrClosed:
+		return nil, 503, errors.New("DB_UNAVAILABLE")
+	}
+	return nil, 500, err
+}
+
+// encodeRecords writes the records returned by it to w for as long as
+// inRange returns true for their keys, honoring the limit and offset in p.
+// If the limit is reached while records remain in range, a token to resume
+// from the next record is returned. Nothing is written if no records are in
+// range.
+func (s *httpServer) encodeRecords(ctx context.Context, w io.Writer, it *sorteddb.Iterator, inRange func(key []byte) bool, p pagination, enc *recordEncoder) (int64, string, error) {
+	defer it.Close()
+	logSeeks(ctx, it.Seeks())
+	var written int64
+	var token string
+	var b []byte
+	var n, scanned int
+	skip := p.offset
+	for it.Next() {
+		if !inRange(it.Key()) {
+			break
+		}
+		scanned++
+		if scanned%1024 == 0 {
+			if err := ctx.Err(); err != nil {
+				return written, "", err
+			}
+		}
+		if skip > 0 {
+			skip--
+			continue
+		}
+		if p.limit > 0 && n == p.limit {
+			token = continuationToken{generation: it.Generation(), offset: it.Offset(), desc: p.desc, query: p.query}.String()
+			break
+		}
+		b = enc.appendRecord(b[:0], it.Key(), it.Record())
+		if s.ctx.maxResponseBytes > 0 && written+int64(len(b)) > int64(s.ctx.maxResponseBytes) {
+			return written, "", sorteddb.ErrLimitExceeded
+		}
+		m, err := w.Write(b)
+		written += int64(m)
+		if err != nil {
+			return written, "", err
+		}
+		n++
+	}
+	if err := it.Err(); err != nil {
+		return written, "", err
+	}
+	m, err := w.Write(enc.appendEnd(b[:0]))
+	written += int64(m)
+	return written, token, err
+}
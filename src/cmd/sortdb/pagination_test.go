@@ -0,0 +1,156 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jehiah/sortdb/src/lib/sorteddb"
+)
+
+// newTestServer returns a httpServer for a db file containing data
+func newTestServer(t *testing.T, data string) (*httpServer, func()) {
+	dir, err := ioutil.TempDir("", "sortdb_http")
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	path := filepath.Join(dir, "db.tab")
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	db, err := sorteddb.New(f)
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	windows, _ := parseStatsWindows("1m")
+	s := NewHTTPServer(&Context{db: db, statsWindows: windows})
+	return s, func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// get requests url from s returning the status, body and continuation token
+func get(s *httpServer, url string) (int, string, string) {
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+	return w.Code, w.Body.String(), w.Header().Get("X-Continuation-Token")
+}
+
+func TestContinuationToken(t *testing.T) {
+	for _, tc := range []continuationToken{
+		{generation: 1, offset: 0, query: queryHash("range", "a", "b")},
+		{generation: 12, offset: 345, desc: true, query: queryHash("fwmatch", "a")},
+	} {
+		got, err := parseContinuationToken(tc.String())
+		if err != nil || *got != tc {
+			t.Errorf("got %+v %v expected %+v", got, err, tc)
+		}
+	}
+	for _, s := range []string{"", "!", "MTox", "MToxOmZmOnVw", "MTotMTpmZjphc2M"} {
+		if _, err := parseContinuationToken(s); err != errInvalidToken {
+			t.Errorf("parseContinuationToken(%q) got error %v expected %s", s, err, errInvalidToken)
+		}
+	}
+	if queryHash("range", "ab", "c") == queryHash("range", "a", "bc") {
+		t.Errorf("expected keys to be delimited in queryHash")
+	}
+}
+
+func TestParsePagination(t *testing.T) {
+	query := queryHash("range", "a", "z")
+	asc := continuationToken{generation: 1, offset: 10, query: query}.String()
+	desc := continuationToken{generation: 1, offset: 10, desc: true, query: query}.String()
+	other := continuationToken{generation: 1, offset: 10, query: queryHash("range", "a", "y")}.String()
+
+	for _, tc := range []struct {
+		args     string
+		expected pagination
+		err      error
+	}{
+		{"", pagination{query: query}, nil},
+		{"order=desc&limit=2&offset=3", pagination{desc: true, limit: 2, offset: 3, query: query}, nil},
+		{"order=sideways", pagination{}, errInvalidOrder},
+		{"limit=-1", pagination{}, errInvalidLimit},
+		{"offset=x", pagination{}, errInvalidOffset},
+		{"limit=2&offset=3&token=" + asc, pagination{limit: 2, query: query}, nil},
+		{"order=desc&token=" + desc, pagination{desc: true, query: query}, nil},
+		{"token=" + desc, pagination{}, errInvalidToken},
+		{"order=desc&token=" + asc, pagination{}, errInvalidToken},
+		{"token=" + other, pagination{}, errInvalidToken},
+	} {
+		p, err := parsePagination(httptest.NewRequest("GET", "/range?"+tc.args, nil), query)
+		if err != tc.err {
+			t.Errorf("%q got error %v expected %v", tc.args, err, tc.err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if p.token != nil && p.token.offset != 10 {
+			t.Errorf("%q got token %+v", tc.args, p.token)
+		}
+		p.token = nil
+		if p != tc.expected {
+			t.Errorf("%q got %+v expected %+v", tc.args, p, tc.expected)
+		}
+	}
+}
+
+func TestPagedRange(t *testing.T) {
+	s, cleanup := newTestServer(t, "a\t1\nb\t2\nc\t3\nd\t4\ne\t5\n")
+	defer cleanup()
+
+	// a token is only returned while the limit truncates the results
+	var keys []string
+	var pages int
+	url := "/range?start=a&end=e&limit=2"
+	for token := ""; pages == 0 || token != ""; pages++ {
+		code, body, next := get(s, url+token)
+		if code != 200 {
+			t.Fatalf("got %d %q", code, body)
+		}
+		keys = append(keys, strings.Fields(body)...)
+		token = ""
+		if next != "" {
+			token = "&token=" + next
+		}
+	}
+	if pages != 3 || strings.Join(keys, " ") != "a 1 b 2 c 3 d 4 e 5" {
+		t.Errorf("got %d pages %q", pages, keys)
+	}
+	if _, _, token := get(s, "/range?start=a&end=e&limit=5"); token != "" {
+		t.Errorf("got token %q when the limit was not reached", token)
+	}
+
+	_, _, token := get(s, "/range?start=a&end=e&limit=2")
+	for _, tc := range []struct {
+		url  string
+		code int
+		body string
+	}{
+		// the offset only applies to the first page
+		{"/range?start=a&end=e&limit=2&offset=1&token=" + token, 200, "c\t3\nd\t4\n"},
+		{"/range?start=a&end=d&limit=2&token=" + token, 400, "INVALID_TOKEN\n"},
+		{"/fwmatch?key=a&limit=2&token=" + token, 400, "INVALID_TOKEN\n"},
+		{"/range?start=a&end=e&limit=2&order=desc&token=" + token, 400, "INVALID_TOKEN\n"},
+	} {
+		if code, body, _ := get(s, tc.url); code != tc.code || body != tc.body {
+			t.Errorf("%s got %d %q expected %d %q", tc.url, code, body, tc.code, tc.body)
+		}
+	}
+
+	if err := s.ctx.db.Remap(); err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	if code, body, _ := get(s, "/range?start=a&end=e&limit=2&token="+token); code != 409 || body != "STALE_TOKEN\n" {
+		t.Errorf("got %d %q after reload expected 409 STALE_TOKEN", code, body)
+	}
+}
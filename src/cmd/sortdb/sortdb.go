@@ -3,24 +3,57 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
 	"runtime"
 	"syscall"
+	"time"
 
 	"github.com/jehiah/sortdb/src/lib/sorteddb"
 	"github.com/jehiah/sortdb/src/lib/util"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "verify":
+			os.Exit(verifyCommand(os.Args[2:]))
+		case "bloom":
+			os.Exit(bloomCommand(os.Args[2:]))
+		}
+	}
+
 	showVersion := flag.Bool("version", false, "print version string")
 	file := flag.String("db-file", "", "db file")
 	httpAddress := flag.String("http-address", ":8080", "http address to listen on")
 	fieldSeparator := flag.String("field-separator", "\t", "field separator (eg: comma, tab, pipe)")
+	quoted := flag.Bool("quoted", false, "fields may be quoted with \" (RFC 4180 csv)")
+	header := flag.Bool("header", false, "the first line of the db file is a header row of column names")
+	keyOrder := flag.String("key-order", "bytes", keyOrderUsage)
 	requestLogging := flag.Bool("enable-logging", false, "request logging")
+	logFile := flag.String("log-file", "", "write request logs to this file instead of stdout (reopened on a USR1 signal)")
+	logFormat := flag.String("log-format", "common", "request log format: common or json")
+	logSampleRate := flag.Float64("log-sample-rate", 1, "fraction of requests to log (0 to 1)")
+	logSlowThreshold := flag.Duration("log-slow-threshold", 0, "only log requests that take at least this long")
 	mlock := flag.Bool("mlock", false, "lock pages in memory")
+	bloomFalsePositiveRate := flag.Float64("bloom-false-positive-rate", 0, "consult a bloom filter with this false positive rate before searching (0 to disable)")
+	indexInterval := flag.Int("index-interval", 0, "keep a sparse in-memory index of every Nth record (0 to disable)")
+	requestTimeout := flag.Duration("request-timeout", 0, "maximum duration of a query request (0 for no limit)")
+	maxResponseBytes := flag.Int("max-response-bytes", 0, "maximum size of a query response (0 for no limit)")
+	maxBufferedResponseBytes := flag.Int("max-buffered-response-bytes", 64<<20, "maximum size of a /mget response to keys in a POST body, which is buffered (0 for no limit)")
+	watch := flag.Bool("watch", false, "reload when the db file changes on disk")
+	watchInterval := flag.Duration("watch-interval", 10*time.Second, "how often to poll the db file for changes when watching")
+	watchDebounce := flag.Duration("watch-debounce", time.Second, "how long the db file must be unchanged before reloading")
+	watchReadyFile := flag.String("watch-ready-file", "", "marker file that must be updated after the db file before reloading")
+	statsdAddress := flag.String("statsd-address", "", "UDP address of a statsd server to send metrics to")
+	statsdPrefix := flag.String("statsd-prefix", "sortdb.{db}.{host}", "prefix for statsd metric names ({db} and {host} are replaced with the db file name and hostname)")
+	statsdInterval := flag.Duration("statsd-interval", 60*time.Second, "how often to send metrics to statsd")
+	statsWindows := flag.String("stats-windows", "1m,5m,15m", "comma separated windows of time to report request timings over in /stats")
+	statsPercentiles := flag.String("stats-percentiles", "50,95,99,99.9", "comma separated request timing percentiles to report in /stats")
 
 	flag.Parse()
 
@@ -32,12 +65,50 @@ func main() {
 	if len(*fieldSeparator) != 1 {
 		log.Fatalf("Error: invalid field separator %q", *fieldSeparator)
 	}
+	comparator, err := parseKeyOrder(*keyOrder)
+	if err != nil {
+		log.Fatalf("Error: %s", err)
+	}
+	if *logFormat != "common" && *logFormat != "json" {
+		log.Fatalf("Error: invalid log format %q", *logFormat)
+	}
+	if *logSampleRate < 0 || *logSampleRate > 1 {
+		log.Fatalf("Error: invalid log sample rate %v", *logSampleRate)
+	}
+	// any of the other logging flags imply -enable-logging
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "log-file", "log-format", "log-sample-rate", "log-slow-threshold":
+			*requestLogging = true
+		}
+	})
+	windows, err := parseStatsWindows(*statsWindows)
+	if err != nil {
+		log.Fatalf("Error: %s %q", err, *statsWindows)
+	}
+	percentiles, err := parsePercentiles(*statsPercentiles)
+	if err != nil {
+		log.Fatalf("Error: %s %q", err, *statsPercentiles)
+	}
+	if *bloomFalsePositiveRate < 0 || *bloomFalsePositiveRate >= 1 {
+		log.Fatalf("Error: invalid bloom false positive rate %v", *bloomFalsePositiveRate)
+	}
 
 	f, err := os.Open(*file)
 	if err != nil {
 		log.Fatalf("ERROR opening %q %s", *file, err)
 	}
-	db, err := sorteddb.New(f)
+	db := &sorteddb.DB{
+		RecordSeparator: []byte(*fieldSeparator)[0],
+		LineEnding:      '\n',
+		IndexInterval:   *indexInterval,
+		Comparator:      comparator,
+		Quoted:          *quoted,
+		HasHeader:       *header,
+
+		BloomFalsePositiveRate: *bloomFalsePositiveRate,
+	}
+	err = db.Open(f)
 	if err != nil {
 		log.Fatalf("ERROR creating db %s", err)
 	}
@@ -47,12 +118,23 @@ func main() {
 			log.Fatalf("Error mlocking db %s", err)
 		}
 	}
-	db.RecordSeparator = []byte(*fieldSeparator)[0]
 
 	ctx := &Context{
 		db:         db,
 		httpAddr:   verifyAddress("http-address", *httpAddress),
 		reloadChan: make(chan int),
+
+		requestTimeout:           *requestTimeout,
+		maxResponseBytes:         *maxResponseBytes,
+		maxBufferedResponseBytes: *maxBufferedResponseBytes,
+		statsWindows:             windows,
+		statsPercentiles:         percentiles,
+	}
+	if *statsdAddress != "" {
+		ctx.statsd, err = newStatsdClient(*statsdAddress, expandStatsdPrefix(*statsdPrefix, *file))
+		if err != nil {
+			log.Fatalf("FATAL: statsd (%s) failed - %s", *statsdAddress, err)
+		}
 	}
 
 	hupChan := make(chan os.Signal, 1)
@@ -64,13 +146,41 @@ func main() {
 		}
 	}()
 	go ctx.ReloadLoop()
+	if *watch {
+		go ctx.WatchLoop(&fileWatcher{
+			path:      *file,
+			readyFile: *watchReadyFile,
+			interval:  *watchInterval,
+			debounce:  *watchDebounce,
+		})
+	}
 
 	httpListener, err := net.Listen("tcp", ctx.httpAddr.String())
 	if err != nil {
 		log.Fatalf("FATAL: listen (%s) failed - %s", ctx.httpAddr, err)
 	}
 	ctx.httpListener = httpListener
-	httpServer := NewHTTPServer(ctx, *requestLogging)
+	s := NewHTTPServer(ctx)
+	var httpServer http.Handler = s
+	if *requestLogging {
+		var out io.Writer = os.Stdout
+		if *logFile != "" {
+			f, err := openLogFile(*logFile)
+			if err != nil {
+				log.Fatalf("ERROR opening %q %s", *logFile, err)
+			}
+			go f.ReopenLoop()
+			out = f
+		}
+		httpServer = LoggingHandler(out, s, logOptions{
+			format:        *logFormat,
+			sampleRate:    *logSampleRate,
+			slowThreshold: *logSlowThreshold,
+		})
+	}
+	if ctx.statsd != nil {
+		go s.StatsdLoop(ctx.statsd, *statsdInterval)
+	}
 
 	exitChan := make(chan int)
 	signalChan := make(chan os.Signal, 1)
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// statsdPacketSize is the largest UDP payload sent to statsd, chosen to avoid
+// fragmentation on typical networks
+const statsdPacketSize = 1432
+
+// statsdClient sends metrics to a statsd server over UDP. A nil client
+// discards all metrics.
+type statsdClient struct {
+	conn   net.Conn
+	prefix string
+
+	sync.Mutex
+	timings statsdBatch // timers waiting for a full packet (or FlushTimings)
+}
+
+func newStatsdClient(address, prefix string) (*statsdClient, error) {
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	c := &statsdClient{conn: conn, prefix: prefix}
+	c.timings.c = c
+	return c, nil
+}
+
+// expandStatsdPrefix expands {db} (the db file name without extension) and {host}
+// (the hostname) in prefix, and ensures it ends with a "."
+func expandStatsdPrefix(prefix, dbFile string) string {
+	db := strings.TrimSuffix(filepath.Base(dbFile), filepath.Ext(dbFile))
+	host, _ := os.Hostname()
+	prefix = strings.ReplaceAll(prefix, "{db}", statsdName(db))
+	prefix = strings.ReplaceAll(prefix, "{host}", statsdName(host))
+	if prefix != "" && !strings.HasSuffix(prefix, ".") {
+		prefix += "."
+	}
+	return prefix
+}
+
+// statsdName replaces characters that have special meaning in a statsd
+// metric name (or to graphite) with "_"
+func statsdName(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '.', ':', '|', '@', '/', ' ', '\t', '\n':
+			return '_'
+		}
+		return r
+	}, s)
+}
+
+// Incr immediately sends a counter increment for stat (eg: for a reload)
+func (c *statsdClient) Incr(stat string) {
+	if c == nil {
+		return
+	}
+	c.send([]byte(fmt.Sprintf("%s%s:1|c", c.prefix, stat)))
+}
+
+// Timing queues a timer (in milliseconds) for stat, eg: the duration of a
+// request. Timers are sent once they fill a packet or by FlushTimings, so that
+// statsd can aggregate every request rather than a summary of them.
+func (c *statsdClient) Timing(stat string, d time.Duration) {
+	if c == nil {
+		return
+	}
+	c.Lock()
+	defer c.Unlock()
+	c.timings.add(stat, strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', 3, 64), "ms")
+}
+
+// FlushTimings sends any queued timers
+func (c *statsdClient) FlushTimings() {
+	c.Lock()
+	defer c.Unlock()
+	c.timings.flush()
+}
+
+func (c *statsdClient) send(b []byte) {
+	_, err := c.conn.Write(b)
+	if err != nil {
+		log.Printf("ERROR: sending to statsd %s", err)
+	}
+}
+
+// statsdBatch collects metrics and sends them in as few packets as possible
+type statsdBatch struct {
+	c   *statsdClient
+	buf []byte
+}
+
+func (b *statsdBatch) add(stat string, value interface{}, kind string) {
+	line := fmt.Sprintf("%s%s:%v|%s", b.c.prefix, stat, value, kind)
+	if len(b.buf) > 0 && len(b.buf)+1+len(line) > statsdPacketSize {
+		b.flush()
+	}
+	if len(b.buf) > 0 {
+		b.buf = append(b.buf, '\n')
+	}
+	b.buf = append(b.buf, line...)
+}
+
+// counter adds the increase of a counter since the previous report. If the
+// counter has gone backwards (ie: it was reset) the current value is used.
+func (b *statsdBatch) counter(stat string, current, previous uint64) {
+	if current < previous {
+		previous = 0
+	}
+	b.add(stat, current-previous, "c")
+}
+
+func (b *statsdBatch) gauge(stat string, value interface{}) {
+	b.add(stat, value, "g")
+}
+
+func (b *statsdBatch) flush() {
+	if len(b.buf) == 0 {
+		return
+	}
+	b.c.send(b.buf)
+	b.buf = b.buf[:0]
+}
+
+// StatsdLoop sends the counters from /stats to statsd every interval (along
+// with any queued request timers). Counters are sent as the change since the
+// previous interval and db details as gauges.
+func (s *httpServer) StatsdLoop(c *statsdClient, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	previous := s.stats()
+	for range ticker.C {
+		c.FlushTimings()
+		stats := s.stats()
+		b := &statsdBatch{c: c}
+		b.counter("requests", stats.Requests, previous.Requests)
+		b.counter("seeks", stats.SeekCount, previous.SeekCount)
+		b.counter("bloom_skips", stats.BloomSkips, previous.BloomSkips)
+
+		b.counter("get.requests", stats.GetRequests, previous.GetRequests)
+		b.counter("get.hits", stats.GetHits, previous.GetHits)
+		b.counter("get.misses", stats.GetMisses, previous.GetMisses)
+
+		b.counter("mget.requests", stats.MgetRequests, previous.MgetRequests)
+		b.counter("mget.hits", stats.MgetHits, previous.MgetHits)
+		b.counter("mget.misses", stats.MgetMisses, previous.MgetMisses)
+
+		b.counter("fwmatch.requests", stats.FwMatchRequests, previous.FwMatchRequests)
+		b.counter("fwmatch.hits", stats.FwMatchHits, previous.FwMatchHits)
+		b.counter("fwmatch.misses", stats.FwMatchMisses, previous.FwMatchMisses)
+
+		b.counter("range.requests", stats.RangeRequests, previous.RangeRequests)
+		b.counter("range.hits", stats.RangeHits, previous.RangeHits)
+		b.counter("range.misses", stats.RangeMisses, previous.RangeMisses)
+
+		b.gauge("db_size", stats.DBSize)
+		b.gauge("db_mtime", stats.DBMtime)
+		b.gauge("index_entries", stats.IndexEntries)
+		b.flush()
+		previous = stats
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatsdTimings(t *testing.T) {
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	defer server.Close()
+	c, err := newStatsdClient(server.LocalAddr().String(), "sortdb.")
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+
+	var nilClient *statsdClient
+	nilClient.Timing("get.request_time", time.Millisecond)
+
+	windows, _ := parseStatsWindows("1m")
+	s := NewHTTPServer(&Context{statsWindows: windows, statsd: c})
+	s.GetMetrics.Status(time.Now().Add(-1500 * time.Microsecond))
+	c.Timing("range.request_time", 250*time.Microsecond)
+	c.FlushTimings()
+
+	buf := make([]byte, statsdPacketSize)
+	server.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := server.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	lines := strings.Split(string(buf[:n]), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "sortdb.get.request_time:1.") || !strings.HasSuffix(lines[0], "|ms") {
+		t.Fatalf("got %q", lines)
+	}
+	if lines[1] != "sortdb.range.request_time:0.250|ms" {
+		t.Errorf("got %q expected sortdb.range.request_time:0.250|ms", lines[1])
+	}
+	if got := s.GetMetrics.Lifetime().count; got != 1 {
+		t.Errorf("got %d timings expected 1", got)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/jehiah/sortdb/src/lib/sorteddb"
+)
+
+// verifyCommand implements `sortdb verify` which checks that a db file is
+// correctly sorted and formatted. It returns the process exit code.
+func verifyCommand(args []string) int {
+	flagSet := flag.NewFlagSet("verify", flag.ExitOnError)
+	file := flagSet.String("db-file", "", "db file")
+	fieldSeparator := flagSet.String("field-separator", "\t", "field separator (eg: comma, tab, pipe)")
+	quoted := flagSet.Bool("quoted", false, "fields may be quoted with \" (RFC 4180 csv)")
+	header := flagSet.Bool("header", false, "the first line of the db file is a header row of column names")
+	keyOrder := flagSet.String("key-order", "bytes", keyOrderUsage)
+	flagSet.Parse(args) // nolint:errcheck
+
+	if *file == "" && flagSet.NArg() == 1 {
+		*file = flagSet.Arg(0)
+	}
+	if len(*fieldSeparator) != 1 {
+		log.Fatalf("Error: invalid field separator %q", *fieldSeparator)
+	}
+	comparator, err := parseKeyOrder(*keyOrder)
+	if err != nil {
+		log.Fatalf("Error: %s", err)
+	}
+
+	f, err := os.Open(*file)
+	if err != nil {
+		log.Fatalf("ERROR opening %q %s", *file, err)
+	}
+	db := &sorteddb.DB{
+		RecordSeparator: []byte(*fieldSeparator)[0],
+		LineEnding:      '\n',
+		Comparator:      comparator,
+		Quoted:          *quoted,
+		HasHeader:       *header,
+	}
+	err = db.Open(f)
+	if err != nil {
+		log.Fatalf("ERROR creating db %s", err)
+	}
+	defer db.Close()
+
+	problems, err := db.Verify()
+	if err != nil {
+		log.Fatalf("ERROR verifying db %s", err)
+	}
+	for _, p := range problems {
+		fmt.Printf("%s: %s\n", *file, p)
+	}
+	if len(problems) > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// fileWatcher detects when the db file is replaced or modified on disk and
+// triggers a reload. Changes are detected with inotify where available and by
+// polling the file size, modification time and inode.
+type fileWatcher struct {
+	path       string
+	readyFile  string // optional marker that must be updated after path
+	interval   time.Duration
+	debounce   time.Duration
+	last       os.FileInfo // db file as of the last reload
+	lastMarker os.FileInfo // ready marker as of the last reload
+}
+
+// changed returns true if fi differs from last in inode, size or modification time
+func changed(last, fi os.FileInfo) bool {
+	return !os.SameFile(last, fi) || fi.Size() != last.Size() || !fi.ModTime().Equal(last.ModTime())
+}
+
+// stable returns true if the file is unchanged between fi and next
+func stable(fi, next os.FileInfo) bool {
+	return next != nil && !changed(fi, next)
+}
+
+// ready returns true if the marker has been updated since the last reload
+// (lastMarker) and no earlier than the db file. Requiring the marker itself to
+// change means a db file renamed into place with an older modification time
+// still waits for it.
+func ready(fi, marker, lastMarker os.FileInfo) bool {
+	if marker == nil {
+		return false
+	}
+	if lastMarker != nil && !changed(lastMarker, marker) {
+		return false
+	}
+	return !marker.ModTime().Before(fi.ModTime())
+}
+
+// statFile returns the FileInfo for path or nil if it can't be read
+func statFile(path string) os.FileInfo {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil
+	}
+	return fi
+}
+
+// waitStable waits until the file has stopped changing for the debounce period
+func (fw *fileWatcher) waitStable(fi os.FileInfo) (os.FileInfo, bool) {
+	for {
+		time.Sleep(fw.debounce)
+		next := statFile(fw.path)
+		if next == nil {
+			return nil, false
+		}
+		if stable(fi, next) {
+			return next, true
+		}
+		fi = next
+	}
+}
+
+// check reloads the DB if the file has changed since the last reload. The
+// change is only recorded once the reload succeeds so that a failed reload is
+// retried.
+func (fw *fileWatcher) check(c *Context) {
+	fi := statFile(fw.path)
+	if fi == nil || !changed(fw.last, fi) {
+		return
+	}
+	fi, ok := fw.waitStable(fi)
+	if !ok {
+		return
+	}
+	var marker os.FileInfo
+	if fw.readyFile != "" {
+		marker = statFile(fw.readyFile)
+		if !ready(fi, marker, fw.lastMarker) {
+			log.Printf("WATCH: %s changed; waiting for %s", fw.path, fw.readyFile)
+			return
+		}
+	}
+	log.Printf("WATCH: %s changed; reloading", fw.path)
+	if c.Reload() != nil {
+		return
+	}
+	fw.last = fi
+	fw.lastMarker = marker
+}
+
+func (c *Context) WatchLoop(fw *fileWatcher) {
+	var err error
+	fw.last, err = os.Stat(fw.path)
+	if err != nil {
+		log.Printf("ERROR: watching %s - %s", fw.path, err)
+		return
+	}
+	if fw.readyFile != "" {
+		fw.lastMarker = statFile(fw.readyFile)
+	}
+
+	// watch the directory so that files renamed into place are detected
+	events, err := watchDir(filepath.Dir(fw.path))
+	if err != nil {
+		log.Printf("WATCH: %s; polling %s every %s", err, fw.path, fw.interval)
+	}
+	ticker := time.NewTicker(fw.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-events:
+		case <-ticker.C:
+		}
+		fw.check(c)
+	}
+}
@@ -0,0 +1,49 @@
+//go:build linux
+
+package main
+
+import (
+	"log"
+	"syscall"
+)
+
+// watchDir returns a channel that receives a value whenever an entry in dir
+// is created, renamed into place, written or removed.
+func watchDir(dir string) (<-chan struct{}, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC)
+	if err != nil {
+		return nil, err
+	}
+	mask := uint32(syscall.IN_CREATE | syscall.IN_MOVED_TO | syscall.IN_CLOSE_WRITE | syscall.IN_DELETE | syscall.IN_ATTRIB)
+	_, err = syscall.InotifyAddWatch(fd, dir, mask)
+	if err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+
+	events := make(chan struct{}, 1)
+	go func() {
+		buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+		for {
+			n, err := syscall.Read(fd, buf)
+			if err == syscall.EINTR {
+				continue
+			}
+			if err != nil {
+				log.Printf("ERROR: inotify read %s", err)
+				syscall.Close(fd)
+				return
+			}
+			if n <= 0 {
+				continue
+			}
+			// the events themselves aren't inspected; the watcher stats
+			// the db file to determine whether it changed
+			select {
+			case events <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	return events, nil
+}
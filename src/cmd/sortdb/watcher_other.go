@@ -0,0 +1,12 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+)
+
+// watchDir is only supported on linux; other platforms fall back to polling
+func watchDir(dir string) (<-chan struct{}, error) {
+	return nil, errors.New("inotify not supported")
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeFile writes data to name in dir with the given modification time and
+// returns its FileInfo
+func writeFile(t *testing.T, dir, name, data string, mtime time.Time) os.FileInfo {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	return fi
+}
+
+// renameFile moves src over dst (as a deploy would) and returns its FileInfo
+func renameFile(t *testing.T, dir, src, dst string) os.FileInfo {
+	if err := os.Rename(filepath.Join(dir, src), filepath.Join(dir, dst)); err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	fi, err := os.Stat(filepath.Join(dir, dst))
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	return fi
+}
+
+func TestWatcherChanged(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sortdb_watcher")
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	now := time.Now().Truncate(time.Second)
+	db := writeFile(t, dir, "db", "a\t1\n", now)
+	sameSize := writeFile(t, dir, "db", "b\t2\n", now)
+	resized := writeFile(t, dir, "db", "a\t1\nb\t2\n", now)
+	touched := writeFile(t, dir, "db", "a\t1\nb\t2\n", now.Add(time.Second))
+	writeFile(t, dir, "db.tmp", "a\t1\nb\t2\n", now.Add(time.Second))
+	replaced := renameFile(t, dir, "db.tmp", "db")
+
+	for _, tc := range []struct {
+		name     string
+		last, fi os.FileInfo
+		expected bool
+	}{
+		{"unchanged", db, db, false},
+		{"rewritten in place with the same size and mtime", db, sameSize, false},
+		{"resized", db, resized, true},
+		{"touched", resized, touched, true},
+		{"replaced with the same size and mtime", touched, replaced, true},
+	} {
+		if got := changed(tc.last, tc.fi); got != tc.expected {
+			t.Errorf("%s: got changed %v expected %v", tc.name, got, tc.expected)
+		}
+		if got := stable(tc.last, tc.fi); got == tc.expected {
+			t.Errorf("%s: got stable %v expected %v", tc.name, got, !tc.expected)
+		}
+	}
+	if stable(db, nil) {
+		t.Errorf("got stable for a missing file")
+	}
+}
+
+func TestWatcherReady(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sortdb_watcher")
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	now := time.Now().Truncate(time.Second)
+	db := writeFile(t, dir, "db", "a\t1\n", now)
+	oldMarker := writeFile(t, dir, "ready", "", now.Add(-time.Minute))
+	marker := writeFile(t, dir, "ready", "", now)
+	newMarker := writeFile(t, dir, "ready", "", now.Add(time.Minute))
+	// a db file moved into place keeping an older modification time
+	olderDB := writeFile(t, dir, "db", "a\t1\n", now.Add(-time.Hour))
+
+	for _, tc := range []struct {
+		name                   string
+		fi, marker, lastMarker os.FileInfo
+		expected               bool
+	}{
+		{"missing marker", db, nil, nil, false},
+		{"marker older than the db file", db, oldMarker, nil, false},
+		{"marker as old as the db file", db, marker, nil, true},
+		{"marker newer than the db file", db, newMarker, nil, true},
+		{"marker updated since the last reload", db, newMarker, marker, true},
+		{"marker not updated since the last reload", db, marker, marker, false},
+		{"older db file and marker not updated since the last reload", olderDB, marker, marker, false},
+		{"older db file and marker updated since the last reload", olderDB, newMarker, marker, true},
+	} {
+		if got := ready(tc.fi, tc.marker, tc.lastMarker); got != tc.expected {
+			t.Errorf("%s: got ready %v expected %v", tc.name, got, tc.expected)
+		}
+	}
+}
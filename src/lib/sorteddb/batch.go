@@ -0,0 +1,100 @@
+package sorteddb
+
+import (
+	"context"
+	"sort"
+	"sync/atomic"
+)
+
+// batchScanRecords is how many records following the previous match are
+// checked before falling back to a binary search for the next needle
+const batchScanRecords = 4
+
+// SearchMany looks up each of needles, returning the full match line (or nil)
+// for each in the same order. Needles are searched in sorted order so that
+// each search only covers the part of the DB after the previous match, and
+// needles close to the previous match are found by scanning forward rather
+// than with a new binary search. It panics if the DB is not open; see GetMany
+// for a variant that returns an error.
+func (db *DB) SearchMany(needles [][]byte) [][]byte {
+	lines, err := db.GetMany(needles)
+	if err != nil {
+		panic(err)
+	}
+	return lines
+}
+
+// GetMany looks up each of needles, returning the full match line (or nil)
+// for each in the same order. ErrNotOpen or ErrClosed is returned if the DB
+// is not mapped.
+func (db *DB) GetMany(needles [][]byte) ([][]byte, error) {
+	return db.GetManyContext(context.Background(), needles)
+}
+
+// GetManyContext is like GetMany but stops with ctx.Err() if ctx is done
+// before all needles have been searched.
+func (db *DB) GetManyContext(ctx context.Context, needles [][]byte) ([][]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	g, err := db.acquireOpen()
+	if err != nil {
+		return nil, err
+	}
+	defer g.release() // nolint:errcheck
+
+	order := make([]int, 0, len(needles))
+	for i, needle := range needles {
+		if g.bloom != nil && !g.bloom.test(needle) {
+			atomic.AddUint64(&db.bloomSkips, 1)
+			continue
+		}
+		order = append(order, i)
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return db.Compare(needles[order[a]], needles[order[b]]) < 0
+	})
+
+	lines := make([][]byte, len(needles))
+	seeks := seekCounter(ctx)
+	lo := g.start
+	for n, i := range order {
+		if n%1024 == 1023 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+		needle := needles[i]
+		lo = db.nextStartOfRange(g, seeks, lo, needle)
+		if lo == g.size {
+			// every remaining needle sorts after the last record
+			break
+		}
+		lines[i] = db.exactMatch(g, lo, needle)
+	}
+	return lines, nil
+}
+
+// nextStartOfRange returns the offset of the first record at or after the
+// record at lo with a key that sorts equal to or after needle, or the end of
+// the DB if there is no such record.
+func (db *DB) nextStartOfRange(g *generation, seeks *uint64, lo int, needle []byte) int {
+	isMatch := func(key []byte) bool {
+		return db.Compare(key, needle) >= 0
+	}
+	for n := 0; n < batchScanRecords && lo < g.size; n++ {
+		db.countSeek(seeks)
+		end := db.endOfLine(g, lo)
+		if end < 0 {
+			end = g.size
+		}
+		if isMatch(db.recordKey(g.data[lo:end])) {
+			return lo
+		}
+		lo = end + 1
+	}
+	if lo >= g.size {
+		return g.size
+	}
+	return db.recordBoundary(g, db.findFirstMatchAfter(g, seeks, lo, isMatch))
+}
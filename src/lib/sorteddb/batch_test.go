@@ -0,0 +1,56 @@
+package sorteddb
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSearchMany(t *testing.T) {
+	needles := [][]byte{[]byte("q"), []byte("a"), []byte("zzzzzz"), []byte(""), []byte("prefix.2"), []byte("a"),
+		[]byte("y"), []byte("aa"), []byte("c1"), []byte("zzzzzzzzzzzzzzzzzzzzzzzzzz"), []byte("zzzzzzzzzzzzzzzzzzzzzzzzzzzzzzz")}
+	for _, name := range []string{"testdata/testdb.tab", "testdata/char_test.tsv"} {
+		for _, interval := range []int{0, 3} {
+			db := openTestDB(t, name, interval)
+			lines := db.SearchMany(needles)
+			if len(lines) != len(needles) {
+				t.Fatalf("got %d lines expected %d", len(lines), len(needles))
+			}
+			for i, needle := range needles {
+				if expected := db.Search(needle); !bytes.Equal(lines[i], expected) {
+					t.Errorf("%s interval %d SearchMany(%q) got %q expected %q", name, interval, needle, lines[i], expected)
+				}
+			}
+			db.Close()
+		}
+	}
+}
+
+// Tests that batches of nearby keys take fewer seeks than searching for each
+func TestSearchManySeeks(t *testing.T) {
+	db := openTestDB(t, "testdata/char_test.tsv", 0)
+	defer db.Close()
+
+	var needles [][]byte
+	it := db.Seek(nil)
+	for it.Next() {
+		needles = append(needles, append([]byte(nil), it.Key()...))
+	}
+	it.Close()
+
+	start := db.SeekCount()
+	for _, needle := range needles {
+		db.Search(needle)
+	}
+	individual := db.SeekCount() - start
+
+	start = db.SeekCount()
+	for i, line := range db.SearchMany(needles) {
+		if line == nil {
+			t.Errorf("SearchMany(%q) got no match", needles[i])
+		}
+	}
+	batched := db.SeekCount() - start
+	if batched*4 > individual {
+		t.Errorf("got %d seeks for SearchMany expected fewer than %d for Search", batched, individual/4)
+	}
+}
@@ -0,0 +1,215 @@
+package sorteddb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log"
+	"math"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// BloomFileSuffix is appended to the DB filename to locate a bloom filter sidecar
+const BloomFileSuffix = ".bloom"
+
+var bloomMagic = [8]byte{'S', 'D', 'B', 'B', 'L', 'O', 'O', 'M'}
+
+const bloomVersion = 1
+
+// ErrStaleBloomFilter is returned when a bloom filter sidecar was not
+// written for the DB file being opened.
+var ErrStaleBloomFilter = errors.New("bloom filter does not match DB file")
+
+// bloomFilter is a fixed size bloom filter over all keys in a generation
+// which allows most lookups for missing keys to skip the binary search.
+type bloomFilter struct {
+	bits []uint64
+	k    uint32
+}
+
+// bloomHeader identifies the DB file a bloom filter sidecar was built from
+type bloomHeader struct {
+	Magic           [8]byte
+	Version         uint32
+	RecordSeparator uint8
+	LineEnding      uint8
+	Quoted          bool
+	HasHeader       bool
+	Size            uint64
+	ModTime         int64
+	K               uint32
+	_               uint32
+	Words           uint64
+}
+
+// newBloomFilter sizes a bloom filter for n keys at the given false positive rate
+func newBloomFilter(n int, fpRate float64) *bloomFilter {
+	if n < 1 {
+		n = 1
+	}
+	m := math.Ceil(-float64(n) * math.Log(fpRate) / (math.Ln2 * math.Ln2))
+	if !(m >= 64) {
+		m = 64
+	}
+	k := math.Round(m / float64(n) * math.Ln2)
+	if k < 1 {
+		k = 1
+	}
+	words := (uint64(m) + 63) / 64
+	return &bloomFilter{bits: make([]uint64, words), k: uint32(k)}
+}
+
+// bloomHashes returns the two hashes used to derive the k bit positions for key
+func bloomHashes(key []byte) (uint64, uint64) {
+	h := fnv.New64a()
+	h.Write(key) // nolint:errcheck
+	h1 := h.Sum64()
+	// splitmix64 finalizer to derive an independent second hash
+	h2 := h1 + 0x9e3779b97f4a7c15
+	h2 = (h2 ^ (h2 >> 30)) * 0xbf58476d1ce4e5b9
+	h2 = (h2 ^ (h2 >> 27)) * 0x94d049bb133111eb
+	h2 ^= h2 >> 31
+	return h1, h2 | 1
+}
+
+func (b *bloomFilter) add(key []byte) {
+	m := uint64(len(b.bits)) * 64
+	h1, h2 := bloomHashes(key)
+	for i := uint64(0); i < uint64(b.k); i++ {
+		bit := (h1 + i*h2) % m
+		b.bits[bit/64] |= 1 << (bit % 64)
+	}
+}
+
+// test returns false if key is definitely not in the filter
+func (b *bloomFilter) test(key []byte) bool {
+	m := uint64(len(b.bits)) * 64
+	h1, h2 := bloomHashes(key)
+	for i := uint64(0); i < uint64(b.k); i++ {
+		bit := (h1 + i*h2) % m
+		if b.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// buildBloomFilter adds every key in g to a new bloom filter
+func (db *DB) buildBloomFilter(g *generation, fpRate float64) *bloomFilter {
+	b := newBloomFilter(bytes.Count(g.data, []byte{db.LineEnding})+1, fpRate)
+	for i := g.start; i < g.size; {
+		end := db.endOfLine(g, i)
+		if end < 0 {
+			end = g.size
+		}
+		b.add(db.recordKey(g.data[i:end]))
+		i = end + 1
+	}
+	return b
+}
+
+func (db *DB) bloomHeader(g *generation, b *bloomFilter) (bloomHeader, error) {
+	fi, err := g.f.Stat()
+	if err != nil {
+		return bloomHeader{}, err
+	}
+	return bloomHeader{
+		Magic:           bloomMagic,
+		Version:         bloomVersion,
+		RecordSeparator: db.RecordSeparator,
+		LineEnding:      db.LineEnding,
+		Quoted:          db.Quoted,
+		HasHeader:       db.HasHeader,
+		Size:            uint64(g.size),
+		ModTime:         fi.ModTime().UnixNano(),
+		K:               b.k,
+		Words:           uint64(len(b.bits)),
+	}, nil
+}
+
+// readBloomFilter reads a bloom filter sidecar, verifying it was built from
+// the file mapped by g.
+func (db *DB) readBloomFilter(g *generation, r io.Reader) (*bloomFilter, error) {
+	var h bloomHeader
+	r = bufio.NewReader(r)
+	if err := binary.Read(r, binary.LittleEndian, &h); err != nil {
+		return nil, err
+	}
+	if h.Magic != bloomMagic || h.Version != bloomVersion {
+		return nil, fmt.Errorf("invalid bloom filter")
+	}
+	if h.K == 0 || h.Words == 0 || h.Words > uint64(g.size) {
+		return nil, fmt.Errorf("invalid bloom filter size %d", h.Words)
+	}
+	b := &bloomFilter{k: h.K}
+	expected, err := db.bloomHeader(g, b)
+	if err != nil {
+		return nil, err
+	}
+	expected.Words = h.Words
+	if h != expected {
+		return nil, ErrStaleBloomFilter
+	}
+	b.bits = make([]uint64, h.Words)
+	if err := binary.Read(r, binary.LittleEndian, b.bits); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// loadBloomFilter reads the bloom filter sidecar for g if one exists and
+// matches, otherwise a new filter is built.
+func (db *DB) loadBloomFilter(g *generation, fpRate float64) *bloomFilter {
+	start := time.Now()
+	name := g.f.Name() + BloomFileSuffix
+	f, err := os.Open(name)
+	if err == nil {
+		defer f.Close()
+		b, err := db.readBloomFilter(g, f)
+		if err == nil {
+			log.Printf("DB Loaded bloom filter %s in %s", name, time.Since(start))
+			return b
+		}
+		log.Printf("DB Ignoring bloom filter %s - %s", name, err)
+	}
+	b := db.buildBloomFilter(g, fpRate)
+	log.Printf("DB Built bloom filter for %s in %s", g.f.Name(), time.Since(start))
+	return b
+}
+
+// WriteBloomFilter builds a bloom filter over all keys of the current
+// mapping and writes it to w in the sidecar format loaded by Open when
+// BloomFalsePositiveRate is set.
+func (db *DB) WriteBloomFilter(w io.Writer, fpRate float64) error {
+	g, err := db.acquireOpen()
+	if err != nil {
+		return err
+	}
+	defer g.release() // nolint:errcheck
+
+	b := db.buildBloomFilter(g, fpRate)
+	h, err := db.bloomHeader(g, b)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	if err := binary.Write(bw, binary.LittleEndian, h); err != nil {
+		return err
+	}
+	if err := binary.Write(bw, binary.LittleEndian, b.bits); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// BloomSkips returns the number of searches answered as misses by the bloom
+// filter without searching the DB
+func (db *DB) BloomSkips() uint64 {
+	return atomic.LoadUint64(&db.bloomSkips)
+}
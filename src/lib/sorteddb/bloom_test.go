@@ -0,0 +1,76 @@
+package sorteddb
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestBloomSearch(t *testing.T) {
+	f, err := os.Open("testdata/testdb.tab")
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	db := &DB{RecordSeparator: '\t', LineEnding: '\n', BloomFalsePositiveRate: 0.001}
+	if err := db.Open(f); err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	for _, tc := range []testSearch{
+		{"a", "first record"},
+		{"aa", "another first"},
+		{"prefix.2", "are"},
+		{"not found", ""},
+		{"zzzzzzzzzzzzzzzzzzzzzzzzzz", "already-asleep"},
+	} {
+		result := db.Search([]byte(tc.needle))
+		if len(result) > 0 {
+			result = result[len(tc.needle)+1:]
+		}
+		if !bytes.Equal(result, []byte(tc.expected)) {
+			t.Errorf("query %q got %q expected %q", tc.needle, result, tc.expected)
+		}
+	}
+	if db.BloomSkips() != 1 {
+		t.Errorf("got %d bloom skips expected 1", db.BloomSkips())
+	}
+}
+
+func TestBloomSidecar(t *testing.T) {
+	f, err := os.Open("testdata/testdb.tab")
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	fTmp, err := ioutil.TempFile("testdata", "tmp_testdb")
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	defer os.Remove(fTmp.Name())
+	io.Copy(fTmp, f) // nolint:errcheck
+
+	db, err := New(fTmp)
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	var buf bytes.Buffer
+	if err := db.WriteBloomFilter(&buf, 0.01); err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	g := db.acquire()
+	defer g.release() // nolint:errcheck
+	b, err := db.readBloomFilter(g, bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	for _, key := range []string{"a", "aa", "prefix.1", "y", "zzzzzzzzzzzzzzzzzzzzzzzzzz"} {
+		if !b.test([]byte(key)) {
+			t.Errorf("expected %q in bloom filter", key)
+		}
+	}
+
+	db.RecordSeparator = ','
+	if _, err := db.readBloomFilter(g, bytes.NewReader(buf.Bytes())); err != ErrStaleBloomFilter {
+		t.Errorf("got error %v expected %v", err, ErrStaleBloomFilter)
+	}
+}
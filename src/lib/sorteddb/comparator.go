@@ -0,0 +1,345 @@
+package sorteddb
+
+import (
+	"bytes"
+	"math"
+	"strconv"
+)
+
+// Comparator defines the order of keys in the DB file. It returns a negative
+// number when a sorts before b, a positive number when a sorts after b and
+// zero when they sort equally (which need not mean they are identical).
+type Comparator func(a, b []byte) int
+
+var (
+	// ByteOrder sorts keys by native byte values (LC_COLLATE=C sort)
+	ByteOrder Comparator = bytes.Compare
+	// NumericOrder sorts keys by leading integer or decimal value (sort -n)
+	NumericOrder Comparator = compareNumeric
+	// FloatOrder sorts keys as floating point numbers including exponents (sort -g)
+	FloatOrder Comparator = compareFloat
+	// CaseFoldOrder sorts keys ignoring ASCII case (sort -f)
+	CaseFoldOrder Comparator = compareCaseFold
+	// VersionOrder sorts keys as version numbers, comparing runs of digits numerically (sort -V)
+	VersionOrder Comparator = compareVersion
+)
+
+// Compare orders a and b using the DB Comparator (or ByteOrder if not set)
+func (db *DB) Compare(a, b []byte) int {
+	if db.Comparator == nil {
+		return bytes.Compare(a, b)
+	}
+	return db.Comparator(a, b)
+}
+
+// HasPrefix reports whether key begins with a prefix that sorts equally to
+// prefix using the DB Comparator. This is meaningful for ByteOrder and
+// CaseFoldOrder.
+func (db *DB) HasPrefix(key, prefix []byte) bool {
+	return len(key) >= len(prefix) && db.Compare(key[:len(prefix)], prefix) == 0
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isBlank(c byte) bool {
+	return c == ' ' || c == '\t'
+}
+
+// parseNumber splits the leading number in s into its sign, integer digits
+// (without leading zeros) and fractional digits (without trailing zeros)
+func parseNumber(s []byte) (negative bool, integer []byte, fraction []byte) {
+	i := 0
+	for i < len(s) && isBlank(s[i]) {
+		i++
+	}
+	if i < len(s) && s[i] == '-' {
+		negative = true
+		i++
+	}
+	start := i
+	for i < len(s) && isDigit(s[i]) {
+		i++
+	}
+	integer = bytes.TrimLeft(s[start:i], "0")
+	if i < len(s) && s[i] == '.' {
+		i++
+		start = i
+		for i < len(s) && isDigit(s[i]) {
+			i++
+		}
+		fraction = bytes.TrimRight(s[start:i], "0")
+	}
+	if len(integer) == 0 && len(fraction) == 0 {
+		// -0 sorts with 0
+		negative = false
+	}
+	return
+}
+
+func compareNumeric(a, b []byte) int {
+	aNegative, aInteger, aFraction := parseNumber(a)
+	bNegative, bInteger, bFraction := parseNumber(b)
+	if aNegative != bNegative {
+		if aNegative {
+			return -1
+		}
+		return 1
+	}
+	c := len(aInteger) - len(bInteger)
+	if c == 0 {
+		c = bytes.Compare(aInteger, bInteger)
+	}
+	if c == 0 {
+		c = bytes.Compare(aFraction, bFraction)
+	}
+	if aNegative {
+		return -c
+	}
+	return c
+}
+
+// parseFloat returns the value of the longest prefix of s that strtod would
+// parse as a number (after leading white space), and whether there is one, so
+// that "12abc" is 12 and "0x10" is 16 as with sort -g. Values are float64
+// rather than long double. Values that are not numbers sort before NaN which
+// sorts before all other numbers.
+func parseFloat(s []byte) (float64, bool) {
+	i := 0
+	for i < len(s) && isSpace(s[i]) {
+		i++
+	}
+	start := i
+	if i < len(s) && (s[i] == '-' || s[i] == '+') {
+		i++
+	}
+	if hasPrefixFold(s[i:], "nan") {
+		return math.NaN(), true
+	}
+	if hasPrefixFold(s[i:], "inf") {
+		if s[start] == '-' {
+			return math.Inf(-1), true
+		}
+		return math.Inf(1), true
+	}
+	if i+2 < len(s) && s[i] == '0' && (s[i+1] == 'x' || s[i+1] == 'X') {
+		if end, ok := scanMantissa(s, i+2, isHexDigit); ok {
+			end = scanExponent(s, end, 'p')
+			f, _ := strconv.ParseFloat(string(s[start:end])+hexExponent(s[start:end]), 64)
+			return f, true
+		}
+	}
+	end, ok := scanMantissa(s, i, isDigit)
+	if !ok {
+		return 0, false
+	}
+	end = scanExponent(s, end, 'e')
+	// out of range values are returned as Inf or 0
+	f, _ := strconv.ParseFloat(string(s[start:end]), 64)
+	return f, true
+}
+
+// isSpace matches the white space skipped by strtod in the C locale
+func isSpace(c byte) bool {
+	return c == ' ' || (c >= '\t' && c <= '\r')
+}
+
+func isHexDigit(c byte) bool {
+	return isDigit(c) || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+// hasPrefixFold reports whether s begins with prefix ignoring ASCII case
+func hasPrefixFold(s []byte, prefix string) bool {
+	return len(s) >= len(prefix) && compareCaseFold(s[:len(prefix)], []byte(prefix)) == 0
+}
+
+// scanMantissa returns the end of the digits (with an optional decimal point)
+// beginning at s[i], and whether there was at least one digit
+func scanMantissa(s []byte, i int, digit func(byte) bool) (int, bool) {
+	digits := 0
+	for ; i < len(s) && digit(s[i]); i++ {
+		digits++
+	}
+	if i < len(s) && s[i] == '.' {
+		for i++; i < len(s) && digit(s[i]); i++ {
+			digits++
+		}
+	}
+	return i, digits > 0
+}
+
+// scanExponent returns the end of an exponent (marker, optional sign and
+// decimal digits) beginning at s[i], or i if there isn't a complete one
+func scanExponent(s []byte, i int, marker byte) int {
+	if i >= len(s) || toUpper(s[i]) != toUpper(marker) {
+		return i
+	}
+	j := i + 1
+	if j < len(s) && (s[j] == '-' || s[j] == '+') {
+		j++
+	}
+	if j >= len(s) || !isDigit(s[j]) {
+		return i
+	}
+	for j < len(s) && isDigit(s[j]) {
+		j++
+	}
+	return j
+}
+
+// hexExponent returns the exponent to append to a hex float if it has none,
+// as strconv.ParseFloat requires one
+func hexExponent(s []byte) string {
+	if bytes.IndexAny(s, "pP") < 0 {
+		return "p0"
+	}
+	return ""
+}
+
+func compareFloat(a, b []byte) int {
+	af, aOK := parseFloat(a)
+	bf, bOK := parseFloat(b)
+	switch {
+	case !aOK || !bOK:
+		return boolCompare(aOK, bOK)
+	case math.IsNaN(af) || math.IsNaN(bf):
+		return boolCompare(!math.IsNaN(af), !math.IsNaN(bf))
+	case af < bf:
+		return -1
+	case af > bf:
+		return 1
+	}
+	return 0
+}
+
+// boolCompare orders false before true
+func boolCompare(a, b bool) int {
+	switch {
+	case a == b:
+		return 0
+	case a:
+		return 1
+	}
+	return -1
+}
+
+func toUpper(c byte) byte {
+	if c >= 'a' && c <= 'z' {
+		return c - ('a' - 'A')
+	}
+	return c
+}
+
+func compareCaseFold(a, b []byte) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		ac, bc := toUpper(a[i]), toUpper(b[i])
+		if ac != bc {
+			return int(ac) - int(bc)
+		}
+	}
+	return len(a) - len(b)
+}
+
+// compareVersion implements filevercmp as used by sort -V: names beginning
+// with "." sort first, then file suffixes (eg: ".tar.gz") are only compared if
+// the rest of the names sort equally.
+func compareVersion(a, b []byte) int {
+	switch {
+	case len(a) == 0 || len(b) == 0:
+		return len(a) - len(b)
+	case a[0] == '.' && b[0] != '.':
+		return -1
+	case a[0] != '.' && b[0] == '.':
+		return 1
+	case a[0] == '.':
+		// "." sorts first, then ".."
+		for _, dots := range []string{".", ".."} {
+			aDots, bDots := string(a) == dots, string(b) == dots
+			if aDots || bDots {
+				return boolCompare(!aDots, !bDots)
+			}
+		}
+	}
+	aPrefix, bPrefix := a[:filePrefixLen(a)], b[:filePrefixLen(b)]
+	c := compareDebianVersion(aPrefix, bPrefix)
+	if c == 0 && (len(aPrefix) != len(a) || len(bPrefix) != len(b)) {
+		c = compareDebianVersion(a, b)
+	}
+	return c
+}
+
+func isAlpha(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// filePrefixLen returns the length of s without its file suffix, the longest
+// match of (\.[A-Za-z~][A-Za-z0-9~]*)*$
+func filePrefixLen(s []byte) int {
+	prefix := 0
+	for i := 0; i < len(s); {
+		i++
+		prefix = i
+		for i+1 < len(s) && s[i] == '.' && (isAlpha(s[i+1]) || s[i+1] == '~') {
+			for i += 2; i < len(s) && (isAlpha(s[i]) || isDigit(s[i]) || s[i] == '~'); i++ {
+			}
+		}
+	}
+	return prefix
+}
+
+// versionOrder returns the weight of s[i] when comparing non-digits: '~'
+// sorts before the end of the string, which sorts before letters, which sort
+// before all other bytes
+func versionOrder(s []byte, i int) int {
+	switch {
+	case i == len(s):
+		return -1
+	case isDigit(s[i]):
+		return 0
+	case isAlpha(s[i]):
+		return int(s[i])
+	case s[i] == '~':
+		return -2
+	}
+	return int(s[i]) + 256
+}
+
+// compareDebianVersion compares alternating runs of non-digits (by
+// versionOrder) and digits (numerically) as with Debian package versions
+func compareDebianVersion(a, b []byte) int {
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		for (i < len(a) && !isDigit(a[i])) || (j < len(b) && !isDigit(b[j])) {
+			if c := versionOrder(a, i) - versionOrder(b, j); c != 0 {
+				return c
+			}
+			i++
+			j++
+		}
+		for i < len(a) && a[i] == '0' {
+			i++
+		}
+		for j < len(b) && b[j] == '0' {
+			j++
+		}
+		firstDiff := 0
+		for i < len(a) && j < len(b) && isDigit(a[i]) && isDigit(b[j]) {
+			if firstDiff == 0 {
+				firstDiff = int(a[i]) - int(b[j])
+			}
+			i++
+			j++
+		}
+		if i < len(a) && isDigit(a[i]) {
+			return 1
+		}
+		if j < len(b) && isDigit(b[j]) {
+			return -1
+		}
+		if firstDiff != 0 {
+			return firstDiff
+		}
+	}
+	return 0
+}
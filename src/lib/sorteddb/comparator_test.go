@@ -0,0 +1,245 @@
+package sorteddb
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestComparators(t *testing.T) {
+	type testCompare struct {
+		a, b     string
+		expected int
+	}
+	tests := []struct {
+		name       string
+		comparator Comparator
+		cases      []testCompare
+	}{
+		{"numeric", NumericOrder, []testCompare{
+			{"2", "10", -1},
+			{"10", "9", 1},
+			{"-10", "-9", -1},
+			{"-1", "1", -1},
+			{"01", "1", 0},
+			{"1.50", "1.5", 0},
+			{"1.45", "1.5", -1},
+			{".5", "0.5", 0},
+			{"-0", "0", 0},
+			{"abc", "0", 0},
+			{"abc", "1", -1},
+			{" 3", "3", 0},
+		}},
+		{"float", FloatOrder, []testCompare{
+			{"2", "10", -1},
+			{"1e3", "999", 1},
+			{"-1.5e-3", "0", -1},
+			{"abc", "NaN", -1},
+			{"NaN", "-Inf", -1},
+			{"abc", "def", 0},
+			{"1.0", "1", 0},
+			{"12abc", "12", 0},
+			{"0x10", "16", 0},
+			{"1e+", "1", 0},
+		}},
+		{"casefold", CaseFoldOrder, []testCompare{
+			{"a", "B", -1},
+			{"abc", "ABC", 0},
+			{"ab", "ABC", -1},
+			{"_", "a", 1},
+			{"_", "A", 1},
+		}},
+		{"version", VersionOrder, []testCompare{
+			{"v2", "v10", -1},
+			{"1.2.10", "1.2.9", 1},
+			{"1.02", "1.2", 0},
+			{"a", "a1", -1},
+			{"file10b", "file10a", 1},
+			{"ab", "a-2", -1},
+			{"a-2", "a.1", -1},
+			{"1.0~rc1", "1.0", -1},
+			{"foo-1.9", "foo-1.10", -1},
+			{"file-1.10", "file-1.10.tar.gz", -1},
+		}},
+	}
+	sign := func(n int) int {
+		switch {
+		case n < 0:
+			return -1
+		case n > 0:
+			return 1
+		}
+		return 0
+	}
+	for _, tt := range tests {
+		for _, c := range tt.cases {
+			if got := sign(tt.comparator([]byte(c.a), []byte(c.b))); got != c.expected {
+				t.Errorf("%s: compare(%q, %q) got %d expected %d", tt.name, c.a, c.b, got, c.expected)
+			}
+			if got := sign(tt.comparator([]byte(c.b), []byte(c.a))); got != -c.expected {
+				t.Errorf("%s: compare(%q, %q) got %d expected %d", tt.name, c.b, c.a, got, -c.expected)
+			}
+		}
+	}
+}
+
+// TestComparatorsMatchSort checks the comparators against files ordered by
+// GNU coreutils 9.1 (LC_ALL=C sort -V and sort -g). Lines sort's last resort
+// comparison puts in byte order may compare equally.
+func TestComparatorsMatchSort(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		comparator Comparator
+	}{
+		{"testdata/version_sort.txt", VersionOrder},
+		{"testdata/float_sort.txt", FloatOrder},
+	} {
+		data, err := ioutil.ReadFile(tt.name)
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+		lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+		for i := range lines {
+			for j := i + 1; j < len(lines); j++ {
+				if tt.comparator([]byte(lines[i]), []byte(lines[j])) > 0 {
+					t.Errorf("%s: %q sorts after %q", tt.name, lines[i], lines[j])
+				}
+				if tt.comparator([]byte(lines[j]), []byte(lines[i])) < 0 {
+					t.Errorf("%s: %q sorts before %q", tt.name, lines[j], lines[i])
+				}
+			}
+		}
+	}
+}
+
+func openComparatorTestDB(t *testing.T, data string, comparator Comparator) *DB {
+	fTmp, err := ioutil.TempFile("testdata", "tmp_comparator")
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	defer os.Remove(fTmp.Name())
+	fTmp.WriteString(data)
+
+	db := &DB{RecordSeparator: '\t', LineEnding: '\n', Comparator: comparator}
+	if err := db.Open(fTmp); err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	return db
+}
+
+func TestNumericOrderSearch(t *testing.T) {
+	db := openComparatorTestDB(t, "-5\ta\n1\tb\n01\tc\n2\td\n10\te\n10\tf\n100\tg\n", NumericOrder)
+	defer db.Close()
+
+	problems, err := db.Verify()
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	if len(problems) != 1 || problems[0].Kind != DuplicateKey || problems[0].Line != 6 {
+		t.Errorf("got problems %v expected a duplicate key on line 6", problems)
+	}
+
+	tests := []testSearch{
+		{"-5", "-5\ta"},
+		{"1", "1\tb"},
+		{"01", "01\tc"},
+		{"2", "2\td"},
+		{"10", "10\te"},
+		{"100", "100\tg"},
+		{"3", ""},
+		{"001", ""},
+	}
+	for _, tt := range tests {
+		if got := string(db.Search([]byte(tt.needle))); got != tt.expected {
+			t.Errorf("Search(%q) got %q expected %q", tt.needle, got, tt.expected)
+		}
+	}
+	for _, tt := range []testRangeSearch{
+		{"1", "10", "1\tb\n01\tc\n2\td\n10\te\n10\tf\n"},
+		{"3", "99", "10\te\n10\tf\n"},
+		{"-10", "0", "-5\ta\n"},
+	} {
+		if got := string(db.RangeMatch([]byte(tt.startNeedle), []byte(tt.endNeedle))); got != tt.expected {
+			t.Errorf("RangeMatch(%q, %q) got %q expected %q", tt.startNeedle, tt.endNeedle, got, tt.expected)
+		}
+	}
+}
+
+func TestCaseFoldOrderSearch(t *testing.T) {
+	db := openComparatorTestDB(t, "Apple\t1\napple\t2\nbanana\t3\nBand\t4\ncherry\t5\n", CaseFoldOrder)
+	defer db.Close()
+
+	problems, err := db.Verify()
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	for _, p := range problems {
+		t.Errorf("got problem %s", p)
+	}
+	for _, tt := range []testSearch{
+		{"Apple", "Apple\t1"},
+		{"apple", "apple\t2"},
+		{"APPLE", ""},
+		{"Band", "Band\t4"},
+	} {
+		if got := string(db.Search([]byte(tt.needle))); got != tt.expected {
+			t.Errorf("Search(%q) got %q expected %q", tt.needle, got, tt.expected)
+		}
+	}
+	if got, expected := string(db.ForwardMatch([]byte("BAN"))), "banana\t3\nBand\t4\n"; got != expected {
+		t.Errorf("ForwardMatch got %q expected %q", got, expected)
+	}
+
+	// the same file is out of order when compared by bytes
+	db.Comparator = ByteOrder
+	problems, err = db.Verify()
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	if len(problems) != 1 || problems[0].Kind != OutOfOrder || problems[0].Line != 4 {
+		t.Errorf("got problems %v expected out of order on line 4", problems)
+	}
+}
+
+// TestLongerNeedle checks searches for needles longer than the keys they sort
+// equally to
+func TestLongerNeedle(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		comparator Comparator
+		needle     string
+		expected   string
+	}{
+		{"bytes", ByteOrder, "1", "1\ta\n"},
+		{"numeric", NumericOrder, "000001", "1\ta\n"},
+		{"float", FloatOrder, "1.00000", "1\ta\n"},
+		{"casefold", CaseFoldOrder, "1", "1\ta\n"},
+		{"version", VersionOrder, "000001", "1\ta\n"},
+	} {
+		for _, interval := range []int{0, 1} {
+			fTmp, err := ioutil.TempFile("testdata", "tmp_comparator")
+			if err != nil {
+				t.Fatalf("got error %s", err)
+			}
+			defer os.Remove(fTmp.Name())
+			fTmp.WriteString("1\ta\n9\tb\n")
+
+			db := &DB{RecordSeparator: '\t', LineEnding: '\n', Comparator: tt.comparator, IndexInterval: interval}
+			if err := db.Open(fTmp); err != nil {
+				t.Fatalf("got error %s", err)
+			}
+			defer db.Close()
+
+			got, err := db.Range([]byte(tt.needle), []byte(tt.needle))
+			if err != nil || string(got) != tt.expected {
+				t.Errorf("%s interval %d: Range(%q) got %q %v expected %q", tt.name, interval, tt.needle, got, err, tt.expected)
+			}
+			it := db.SeekReverse([]byte(tt.needle))
+			if !it.Next() || string(it.Key()) != "1" {
+				t.Errorf("%s interval %d: SeekReverse(%q) got %q", tt.name, interval, tt.needle, it.Key())
+			}
+			it.Close()
+		}
+	}
+}
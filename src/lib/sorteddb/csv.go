@@ -0,0 +1,163 @@
+package sorteddb
+
+import (
+	"bytes"
+	"sort"
+	"time"
+)
+
+// Quote encloses fields containing a RecordSeparator, LineEnding or Quote
+// when DB.Quoted is set. A Quote within a quoted field is escaped by
+// doubling it (RFC 4180).
+const Quote = '"'
+
+// recordCheckpointSize is the spacing (in bytes) of the records kept in a
+// recordTable. Locating a record scans forward from the preceding checkpoint,
+// which is at most this far plus the length of a record.
+const recordCheckpointSize = 4096
+
+// recordTable holds the offset of the first record beginning in each
+// recordCheckpointSize block of a Quoted DB. Record boundaries can't be found
+// by scanning backwards for a LineEnding when quoted fields may contain one,
+// so they are found by scanning forwards from a known boundary.
+type recordTable struct {
+	offsets   []int // of each checkpoint record
+	ordinals  []int // number of records before each checkpoint
+	records   int
+	buildTime time.Duration
+}
+
+// RecordTableStats describes the record table of a Quoted DB
+type RecordTableStats struct {
+	Records     int
+	Checkpoints int
+	Bytes       int
+	BuildTime   time.Duration
+}
+
+// buildRecordTable scans g recording a checkpoint in each block
+func (db *DB) buildRecordTable(g *generation) *recordTable {
+	start := time.Now()
+	t := &recordTable{}
+	next := 0
+	for i := 0; i < g.size; t.records++ {
+		if i >= next {
+			t.offsets = append(t.offsets, i)
+			t.ordinals = append(t.ordinals, t.records)
+			next = (i/recordCheckpointSize + 1) * recordCheckpointSize
+		}
+		i += db.recordLength(g.data[i:]) + 1
+	}
+	t.buildTime = time.Since(start)
+	return t
+}
+
+// findRecord returns the offset and ordinal of the record of a Quoted DB that
+// includes offset i
+func (db *DB) findRecord(g *generation, i int) (int, int) {
+	t := g.records
+	j := sort.Search(len(t.offsets), func(j int) bool {
+		return t.offsets[j] > i
+	}) - 1
+	if j < 0 {
+		return 0, 0
+	}
+	start, n := t.offsets[j], t.ordinals[j]
+	for {
+		next := start + db.recordLength(g.data[start:]) + 1
+		if next > i || next >= g.size {
+			return start, n
+		}
+		start = next
+		n++
+	}
+}
+
+func (t *recordTable) stats() RecordTableStats {
+	return RecordTableStats{
+		Records:     t.records,
+		Checkpoints: len(t.offsets),
+		Bytes:       (len(t.offsets) + len(t.ordinals)) * 8,
+		BuildTime:   t.buildTime,
+	}
+}
+
+// RecordTableStats returns the size and build time of the record table for
+// the current mapping. The zero value is returned if the DB is not Quoted.
+func (db *DB) RecordTableStats() RecordTableStats {
+	g := db.current()
+	if g == nil || g.records == nil {
+		return RecordTableStats{}
+	}
+	return g.records.stats()
+}
+
+// recordLength returns the length (excluding the LineEnding) of the record
+// at the beginning of data
+func (db *DB) recordLength(data []byte) int {
+	if !db.Quoted {
+		if i := bytes.IndexByte(data, db.LineEnding); i >= 0 {
+			return i
+		}
+		return len(data)
+	}
+	fieldStart, quoted := true, false
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		switch {
+		case quoted:
+			if c == Quote {
+				if i+1 < len(data) && data[i+1] == Quote {
+					i++
+				} else {
+					quoted = false
+				}
+			}
+		case c == db.LineEnding:
+			return i
+		case c == db.RecordSeparator:
+			fieldStart = true
+			continue
+		case c == Quote && fieldStart:
+			quoted = true
+		}
+		fieldStart = false
+	}
+	return len(data)
+}
+
+// SplitKey splits a record into its key and the value following the
+// RecordSeparator after the key. When the DB is Quoted the key is returned
+// unquoted. ok is false if the key is not followed by a RecordSeparator.
+func (db *DB) SplitKey(record []byte) (key []byte, value []byte, ok bool) {
+	if !db.Quoted || len(record) == 0 || record[0] != Quote {
+		i := bytes.IndexByte(record, db.RecordSeparator)
+		if i < 0 {
+			return record, nil, false
+		}
+		return record[:i], record[i+1:], true
+	}
+	escaped := false
+	i := 1
+	for ; i < len(record); i++ {
+		if record[i] != Quote {
+			continue
+		}
+		if i+1 < len(record) && record[i+1] == Quote {
+			escaped = true
+			i++
+			continue
+		}
+		break
+	}
+	key = record[1:i]
+	if escaped {
+		key = bytes.ReplaceAll(key, []byte{Quote, Quote}, []byte{Quote})
+	}
+	// skip the closing quote
+	i++
+	if i >= len(record) || record[i] != db.RecordSeparator {
+		return key, nil, false
+	}
+	return key, record[i+1:], true
+}
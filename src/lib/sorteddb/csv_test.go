@@ -0,0 +1,222 @@
+package sorteddb
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+const quotedTestData = "\"a,1\",x\nb,\"multi\nline\"\n\"c\"\"q\",y\nd,z\n\"e\nf\",w\ng,\"1,2\"\ng,3\n"
+
+func openQuotedTestDB(t *testing.T, indexInterval int) *DB {
+	fTmp, err := ioutil.TempFile("testdata", "tmp_quoted")
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	defer os.Remove(fTmp.Name())
+	fTmp.WriteString(quotedTestData)
+
+	db := &DB{RecordSeparator: ',', LineEnding: '\n', Quoted: true, IndexInterval: indexInterval}
+	if err := db.Open(fTmp); err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	return db
+}
+
+func TestSplitKey(t *testing.T) {
+	db := &DB{RecordSeparator: ',', LineEnding: '\n', Quoted: true}
+	tests := []struct {
+		record, key, value string
+		ok                 bool
+	}{
+		{"a,b", "a", "b", true},
+		{"\"a,b\",c", "a,b", "c", true},
+		{"\"a\"\"b\",c,d", "a\"b", "c,d", true},
+		{"\"a\nb\",\"c\"", "a\nb", "\"c\"", true},
+		{"\"a\"", "a", "", false},
+		{"a", "a", "", false},
+		{"a\"b,c", "a\"b", "c", true},
+	}
+	for _, tt := range tests {
+		key, value, ok := db.SplitKey([]byte(tt.record))
+		if string(key) != tt.key || string(value) != tt.value || ok != tt.ok {
+			t.Errorf("SplitKey(%q) got %q %q %v expected %q %q %v", tt.record, key, value, ok, tt.key, tt.value, tt.ok)
+		}
+	}
+}
+
+func TestQuotedSearch(t *testing.T) {
+	for _, interval := range []int{0, 1, 2} {
+		db := openQuotedTestDB(t, interval)
+		defer db.Close()
+
+		problems, err := db.Verify()
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+		if len(problems) != 1 || problems[0].Kind != DuplicateKey || problems[0].Line != 9 {
+			t.Errorf("got problems %v expected a duplicate key on line 9", problems)
+		}
+
+		tests := []testSearch{
+			{"a,1", "\"a,1\",x"},
+			{"a", ""},
+			{"b", "b,\"multi\nline\""},
+			{"line\"", ""},
+			{"c\"q", "\"c\"\"q\",y"},
+			{"d", "d,z"},
+			{"e\nf", "\"e\nf\",w"},
+			{"f\"", ""},
+			{"g", "g,\"1,2\""},
+			{"h", ""},
+		}
+		for _, tt := range tests {
+			if got := string(db.Search([]byte(tt.needle))); got != tt.expected {
+				t.Errorf("interval %d Search(%q) got %q expected %q", interval, tt.needle, got, tt.expected)
+			}
+		}
+
+		records := db.SearchAll([]byte("g"))
+		if len(records) != 2 || string(records[0]) != "g,\"1,2\"" || string(records[1]) != "g,3" {
+			t.Errorf("interval %d SearchAll got %q", interval, records)
+		}
+
+		if got, expected := string(db.RangeMatch([]byte("b"), []byte("d"))), "b,\"multi\nline\"\n\"c\"\"q\",y\nd,z\n"; got != expected {
+			t.Errorf("interval %d RangeMatch got %q expected %q", interval, got, expected)
+		}
+		if got, expected := string(db.ForwardMatch([]byte("e"))), "\"e\nf\",w\n"; got != expected {
+			t.Errorf("interval %d ForwardMatch got %q expected %q", interval, got, expected)
+		}
+		if _, err := db.RangeContext(context.Background(), []byte("a"), []byte("e\nf"), Limits{MaxRecords: 4}); err != ErrLimitExceeded {
+			t.Errorf("interval %d got error %v expected %s", interval, err, ErrLimitExceeded)
+		}
+		if _, err := db.RangeContext(context.Background(), []byte("a"), []byte("e\nf"), Limits{MaxRecords: 5}); err != nil {
+			t.Errorf("interval %d got error %s", interval, err)
+		}
+	}
+}
+
+func TestQuotedIterator(t *testing.T) {
+	db := openQuotedTestDB(t, 0)
+	defer db.Close()
+
+	expected := []struct {
+		key, value string
+	}{
+		{"e\nf", "w"},
+		{"d", "z"},
+		{"c\"q", "y"},
+		{"b", "\"multi\nline\""},
+	}
+	it := db.SeekReverse([]byte("e\nf"))
+	defer it.Close()
+	for i := 0; it.Next(); i++ {
+		if i == len(expected) {
+			break
+		}
+		if string(it.Key()) != expected[i].key || string(it.Value()) != expected[i].value {
+			t.Errorf("got %q %q expected %q %q", it.Key(), it.Value(), expected[i].key, expected[i].value)
+		}
+		if _, err := db.SeekOffset(it.Generation(), it.Offset()+1, false); err != ErrInvalidOffset {
+			t.Errorf("SeekOffset(%d) got error %v expected %s", it.Offset()+1, err, ErrInvalidOffset)
+		}
+	}
+	if err := it.Err(); err != nil {
+		t.Fatalf("got error %s", err)
+	}
+}
+
+func TestQuotedCheckpoints(t *testing.T) {
+	var data strings.Builder
+	var records []string
+	for i := 0; i < 2000; i++ {
+		value := fmt.Sprintf("\"%d\nquoted, \"\"%d\"\"\"", i, i)
+		if i%7 == 0 {
+			// long records span several checkpoint blocks
+			value = "\"" + strings.Repeat("a\nb,", recordCheckpointSize/2) + "\""
+		}
+		record := fmt.Sprintf("k%05d,%s", i, value)
+		records = append(records, record)
+		data.WriteString(record + "\n")
+	}
+
+	fTmp, err := ioutil.TempFile("testdata", "tmp_quoted")
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	defer os.Remove(fTmp.Name())
+	fTmp.WriteString(data.String())
+	db := &DB{RecordSeparator: ',', LineEnding: '\n', Quoted: true}
+	if err := db.Open(fTmp); err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	defer db.Close()
+
+	stats := db.RecordTableStats()
+	if stats.Records != len(records) || stats.Checkpoints <= 1 || stats.Checkpoints >= stats.Records {
+		t.Errorf("got record table stats %+v", stats)
+	}
+	if problems, err := db.Verify(); err != nil || len(problems) != 0 {
+		t.Errorf("got problems %v error %v", problems, err)
+	}
+	for i, record := range records {
+		needle := fmt.Sprintf("k%05d", i)
+		if got := string(db.Search([]byte(needle))); got != record {
+			t.Fatalf("Search(%q) got %q expected %q", needle, got, record)
+		}
+	}
+	if _, err := db.RangeContext(context.Background(), []byte("k00100"), []byte("k00199"), Limits{MaxRecords: 99}); err != ErrLimitExceeded {
+		t.Errorf("got error %v expected %s", err, ErrLimitExceeded)
+	}
+	if _, err := db.RangeContext(context.Background(), []byte("k00100"), []byte("k00199"), Limits{MaxRecords: 100}); err != nil {
+		t.Errorf("got error %s", err)
+	}
+
+	it := db.SeekReverse([]byte("k99999"))
+	defer it.Close()
+	i := len(records) - 1
+	for ; it.Next(); i-- {
+		if string(it.Record()) != records[i] {
+			t.Fatalf("got record %q expected %q", it.Record(), records[i])
+		}
+	}
+	if i != -1 || it.Err() != nil {
+		t.Errorf("reverse iteration stopped at %d with error %v", i, it.Err())
+	}
+}
+
+// TestQuotedShortKey searches for an unquoted key that is shorter than the
+// quoted record it is in (which is longer than the rest of the file)
+func TestQuotedShortKey(t *testing.T) {
+	for _, interval := range []int{0, 1} {
+		fTmp, err := ioutil.TempFile("testdata", "tmp_quoted")
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+		defer os.Remove(fTmp.Name())
+		fTmp.WriteString("\"a\"\"\n\",0\nb,1")
+
+		db := &DB{RecordSeparator: ',', LineEnding: '\n', Quoted: true, IndexInterval: interval}
+		if err := db.Open(fTmp); err != nil {
+			t.Fatalf("got error %s", err)
+		}
+		defer db.Close()
+
+		needle := []byte("a\"\n")
+		expected := "\"a\"\"\n\",0\n"
+		if got, err := db.Range(needle, needle); err != nil || string(got) != expected {
+			t.Errorf("interval %d Range got %q %v expected %q", interval, got, err, expected)
+		}
+		if got, err := db.Prefix(needle); err != nil || string(got) != expected {
+			t.Errorf("interval %d Prefix got %q %v expected %q", interval, got, err, expected)
+		}
+		it := db.SeekReverse(needle)
+		if !it.Next() || string(it.Key()) != string(needle) {
+			t.Errorf("interval %d SeekReverse got %q", interval, it.Key())
+		}
+		it.Close()
+	}
+}
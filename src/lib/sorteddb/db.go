@@ -1,6 +1,8 @@
 package sorteddb
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -11,44 +13,77 @@ import (
 	"github.com/riobard/go-mmap"
 )
 
+var (
+	// ErrNotOpen is returned when querying a DB that has not been opened
+	ErrNotOpen = errors.New("DB not open")
+	// ErrClosed is returned when querying a DB after Close
+	ErrClosed = errors.New("DB closed")
+)
+
 type DB struct {
 	RecordSeparator byte
 	LineEnding      byte
 
-	f         *os.File
-	data      mmap.Mmap
-	seekCount uint64
-	size      int
-	mlock     bool
-
-	mutex sync.RWMutex
+	// Comparator is the order keys in the DB file are sorted by. The default
+	// (nil) is ByteOrder.
+	Comparator Comparator
+
+	// Quoted enables RFC 4180 (CSV) quoting. Keys may be enclosed in Quote
+	// characters and are unquoted before comparison, and quoted fields may
+	// contain the RecordSeparator or LineEnding. A table of record offsets is
+	// built each time the DB is opened. It must be set before Open.
+	Quoted bool
+
+	// HasHeader treats the first line of the file as a header row of column
+	// names (see Columns) which is excluded from queries. It must be set
+	// before Open.
+	HasHeader bool
+
+	// IndexInterval enables a sparse in-memory index of every Nth record
+	// that is built each time the DB is opened. It must be set before Open.
+	IndexInterval int
+
+	// BloomFalsePositiveRate enables a bloom filter over all keys that is
+	// consulted by Search to skip the binary search for missing keys. The
+	// filter is loaded from a sidecar file (see WriteBloomFilter) when one
+	// matching the DB file exists, otherwise it is built when the DB is
+	// opened. It must be set before Open.
+	BloomFalsePositiveRate float64
+
+	generation     atomic.Value // *generation
+	lastGeneration uint64
+	seekCount      uint64
+	bloomSkips     uint64
+	mlock          bool
+	closed         int32
+
+	// mutex serializes changes to the mapping; readers never take it
+	mutex sync.Mutex
 }
 
 // Create a new DB structure Opened against the specified file
 func New(f *os.File) (*DB, error) {
-	db := &DB{RecordSeparator: '\t', LineEnding: '\n', size: -1}
+	db := &DB{RecordSeparator: '\t', LineEnding: '\n'}
 	err := db.Open(f)
 	return db, err
 }
 
 // Info returns the mmaped backing file size and modification time
 func (db *DB) Info() (int, time.Time) {
-	db.mutex.RLock()
-	defer db.mutex.RUnlock()
-	if db.f == nil {
+	g := db.acquire()
+	if g == nil {
 		return 0, time.Time{}
 	}
-	fi, _ := db.f.Stat()
-	return db.size, fi.ModTime()
+	defer g.release() // nolint:errcheck
+	fi, _ := g.f.Stat()
+	return g.size, fi.ModTime()
 }
 
-// Open the DB against a backing file
+// Open the DB against a backing file. The new file is mapped (and Mlocked if
+// enabled) before being swapped in, so queries in flight continue against the
+// previous mapping which is unmapped once they complete. If the new file can
+// not be mapped the existing mapping (if any) is left in place.
 func (db *DB) Open(f *os.File) error {
-	db.mutex.Lock()
-	defer db.mutex.Unlock()
-	if db.f != nil {
-		db.close()
-	}
 	fi, err := f.Stat()
 	if err != nil {
 		return err
@@ -62,55 +97,54 @@ func (db *DB) Open(f *os.File) error {
 	if err != nil {
 		return err
 	}
-	db.f = f
-	db.data = data
-	db.size = size
+	g := &generation{f: f, data: data, size: size, refs: 1}
+	if db.Quoted {
+		g.records = db.buildRecordTable(g)
+		log.Printf("DB Found %d records in %s in %s", g.records.records, f.Name(), g.records.buildTime)
+	}
+	if db.HasHeader {
+		db.readHeader(g)
+	}
+	if db.IndexInterval > 0 {
+		g.index = db.buildIndex(g, db.IndexInterval)
+		log.Printf("DB Indexed %d records of %s in %s", len(g.index.offsets), f.Name(), g.index.buildTime)
+	}
+	if db.BloomFalsePositiveRate > 0 {
+		g.bloom = db.loadBloomFilter(g, db.BloomFalsePositiveRate)
+	}
+
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
 	if db.mlock {
-		data.Lock()
+		g.mlock() // nolint:errcheck
 	}
+	db.lastGeneration++
+	g.id = db.lastGeneration
+	db.swap(g) // nolint:errcheck
+	atomic.StoreInt32(&db.closed, 0)
 	return nil
 }
 
 // Close and unmap the existing DB backing file
-// If Mlocked, data will be munlocked
+// If Mlocked, data will be munlocked. The mapping is released once any
+// queries in flight complete.
 func (db *DB) Close() error {
 	db.mutex.Lock()
 	defer db.mutex.Unlock()
-	return db.close()
-}
-
-// close and unmap DB w/o locking
-func (db *DB) close() (err error) {
-	if db.data != nil {
-		if db.mlock {
-			db.munlock()
-		}
-		var name string
-		if db.f != nil {
-			name = db.f.Name()
-		}
-		log.Printf("DB Unmmap %d bytes %s", db.size, name)
-		err = db.data.Unmap()
-		db.data = nil
-	}
-	if db.f != nil {
-		log.Printf("Closing file %s", db.f.Name())
-		db.f.Close()
-		db.f = nil
-	}
-	db.size = -1
-	return
+	atomic.StoreInt32(&db.closed, 1)
+	if db.current() == nil {
+		return nil
+	}
+	return db.swap(nil)
 }
 
 // Remap DB to the same backing file
 func (db *DB) Remap() error {
-	db.mutex.RLock()
-	if db.f == nil {
-		db.mutex.RUnlock()
-		return fmt.Errorf("DB must be open to remap")
+	g := db.current()
+	if g == nil {
+		return db.notOpenErr()
 	}
-	filename := db.f.Name()
-	db.mutex.RUnlock()
+	filename := g.f.Name()
 
 	log.Printf("DB Remapping %s", filename)
 	f, err := os.Open(filename)
@@ -119,6 +153,7 @@ func (db *DB) Remap() error {
 	}
 	err = db.Open(f)
 	if err != nil {
+		f.Close()
 		return err
 	}
 	return nil
@@ -127,29 +162,68 @@ func (db *DB) Remap() error {
 // Mlock prevent the mmap from being paged to the swap area.
 func (db *DB) Mlock() error {
 	db.mutex.Lock()
-	if db.data == nil {
-		return fmt.Errorf("db not open")
-	}
 	defer db.mutex.Unlock()
+	g := db.current()
+	if g == nil {
+		return db.notOpenErr()
+	}
 	db.mlock = true
-	return db.data.Lock()
+	return g.mlock()
 }
 
 // Munlock calls syscall.Munlock on the underlying data if already Mlock'd
 func (db *DB) Munlock() error {
 	db.mutex.Lock()
-	if db.data == nil {
-		return fmt.Errorf("db not open")
-	}
 	defer db.mutex.Unlock()
-	return db.munlock()
+	g := db.current()
+	if g == nil {
+		return db.notOpenErr()
+	}
+	db.mlock = false
+	return g.munlock()
 }
 
-func (db *DB) munlock() error {
-	db.mlock = false
-	return db.data.Unlock()
+// Mlocked returns true if the current mapping is locked in memory
+func (db *DB) Mlocked() bool {
+	g := db.current()
+	if g == nil {
+		return false
+	}
+	return atomic.LoadInt32(&g.mlocked) == 1
+}
+
+// Generation returns a counter that is incremented each time the DB is mapped
+func (db *DB) Generation() uint64 {
+	g := db.current()
+	if g == nil {
+		return 0
+	}
+	return g.id
 }
 
 func (db *DB) SeekCount() uint64 {
 	return atomic.LoadUint64(&db.seekCount)
 }
+
+type seekCounterKey struct{}
+
+// WithSeekCounter returns a copy of ctx which has the queries it is passed
+// to (eg: GetContext) add the seeks they make to n, as well as to SeekCount,
+// so that the seeks made by a single request can be counted.
+func WithSeekCounter(ctx context.Context, n *uint64) context.Context {
+	return context.WithValue(ctx, seekCounterKey{}, n)
+}
+
+// seekCounter returns the counter set on ctx with WithSeekCounter, or nil
+func seekCounter(ctx context.Context) *uint64 {
+	n, _ := ctx.Value(seekCounterKey{}).(*uint64)
+	return n
+}
+
+// countSeek adds a seek to SeekCount and to seeks (if not nil)
+func (db *DB) countSeek(seeks *uint64) {
+	atomic.AddUint64(&db.seekCount, 1)
+	if seeks != nil {
+		atomic.AddUint64(seeks, 1)
+	}
+}
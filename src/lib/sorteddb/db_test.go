@@ -0,0 +1,125 @@
+package sorteddb
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// Tests that a failed Open leaves the existing mapping in place
+func TestOpenFailureKeepsMapping(t *testing.T) {
+	f, err := os.Open("testdata/testdb.tab")
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	db, err := New(f)
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	fTmp, err := ioutil.TempFile("testdata", "tmp_empty")
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	defer os.Remove(fTmp.Name())
+
+	if err := db.Open(fTmp); err == nil {
+		t.Fatalf("expected error opening empty file")
+	}
+	if result := db.Search([]byte("q")); string(result) != "q\tr" {
+		t.Errorf("got %q expected %q", result, "q\tr")
+	}
+}
+
+// Tests that a generation held by a reader stays mapped after a remap and is
+// released once the reader is done.
+func TestRemapWhileReading(t *testing.T) {
+	f, err := os.Open("testdata/testdb.tab")
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	db, err := New(f)
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	g := db.acquire()
+	if err := db.Remap(); err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	if db.Generation() != g.id+1 {
+		t.Errorf("got generation %d expected %d", db.Generation(), g.id+1)
+	}
+	if i := db.beginningOfLine(g, db.findStartOfRange(g, nil, []byte("q"))); string(g.data[i:i+3]) != "q\tr" {
+		t.Errorf("got %q from previous generation", g.data[i:i+3])
+	}
+	g.release() // nolint:errcheck
+	if g.acquire() {
+		t.Errorf("expected released generation to not be acquired")
+	}
+	db.Close()
+	if db.acquire() != nil {
+		t.Errorf("expected no generation after Close")
+	}
+}
+
+func TestNotOpen(t *testing.T) {
+	db := &DB{RecordSeparator: '\t', LineEnding: '\n'}
+	if _, err := db.Get([]byte("a")); err != ErrNotOpen {
+		t.Errorf("got error %v expected %v", err, ErrNotOpen)
+	}
+	if err := db.Mlock(); err != ErrNotOpen {
+		t.Errorf("got error %v expected %v", err, ErrNotOpen)
+	}
+	// a second call would deadlock if the first did not unlock
+	if err := db.Munlock(); err != ErrNotOpen {
+		t.Errorf("got error %v expected %v", err, ErrNotOpen)
+	}
+
+	f, err := os.Open("testdata/testdb.tab")
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	if err := db.Open(f); err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	db.Close()
+	if _, err := db.Range([]byte("a"), []byte("b")); err != ErrClosed {
+		t.Errorf("got error %v expected %v", err, ErrClosed)
+	}
+	if _, err := db.Prefix([]byte("a")); err != ErrClosed {
+		t.Errorf("got error %v expected %v", err, ErrClosed)
+	}
+	if err := db.Remap(); err != ErrClosed {
+		t.Errorf("got error %v expected %v", err, ErrClosed)
+	}
+	it := db.Seek([]byte("a"))
+	if it.Next() || it.Err() != ErrClosed {
+		t.Errorf("got error %v expected %v", it.Err(), ErrClosed)
+	}
+}
+
+// Tests that WithSeekCounter counts the seeks made by queries using ctx
+func TestSeekCounter(t *testing.T) {
+	db := openTestDB(t, "testdata/testdb.tab", 0)
+	defer db.Close()
+
+	var n uint64
+	ctx := WithSeekCounter(context.Background(), &n)
+	start := db.SeekCount()
+	if _, err := db.GetContext(ctx, []byte("q")); err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	if _, err := db.RangeContext(ctx, []byte("a"), []byte("c"), Limits{}); err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	if n == 0 || n != db.SeekCount()-start {
+		t.Errorf("got %d seeks expected %d", n, db.SeekCount()-start)
+	}
+
+	before := db.SeekCount()
+	it := db.Seek([]byte("q"))
+	defer it.Close()
+	if it.Seeks() == 0 || it.Seeks() != db.SeekCount()-before {
+		t.Errorf("got %d iterator seeks expected %d", it.Seeks(), db.SeekCount()-before)
+	}
+}
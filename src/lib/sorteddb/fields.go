@@ -0,0 +1,66 @@
+package sorteddb
+
+import (
+	"bytes"
+)
+
+// SplitFields splits a record on the RecordSeparator. When the DB is Quoted
+// separators within quoted fields are skipped and fields are returned with
+// their quotes intact so that they may be joined again (see Unquote).
+func (db *DB) SplitFields(record []byte) [][]byte {
+	if !db.Quoted {
+		return bytes.Split(record, []byte{db.RecordSeparator})
+	}
+	var fields [][]byte
+	start := 0
+	quoted := false
+	for i := 0; i < len(record); i++ {
+		c := record[i]
+		switch {
+		case quoted:
+			if c == Quote {
+				if i+1 < len(record) && record[i+1] == Quote {
+					i++
+				} else {
+					quoted = false
+				}
+			}
+		case c == db.RecordSeparator:
+			fields = append(fields, record[start:i])
+			start = i + 1
+		case c == Quote && i == start:
+			quoted = true
+		}
+	}
+	return append(fields, record[start:])
+}
+
+// SelectFields returns the fields of record at the given positions (the key
+// is 0) joined by the RecordSeparator. Positions past the end of the record
+// select empty fields.
+func (db *DB) SelectFields(record []byte, positions []int) []byte {
+	fields := db.SplitFields(record)
+	var b []byte
+	for i, n := range positions {
+		if i > 0 {
+			b = append(b, db.RecordSeparator)
+		}
+		if n >= 0 && n < len(fields) {
+			b = append(b, fields[n]...)
+		}
+	}
+	return b
+}
+
+// Unquote returns the contents of a quoted field when the DB is Quoted.
+// Other fields are returned unchanged.
+func (db *DB) Unquote(field []byte) []byte {
+	if !db.Quoted || len(field) < 2 || field[0] != Quote || field[len(field)-1] != Quote {
+		return field
+	}
+	field = field[1 : len(field)-1]
+	if bytes.Contains(field, []byte{Quote, Quote}) {
+		return bytes.ReplaceAll(field, []byte{Quote, Quote}, []byte{Quote})
+	}
+	return field
+}
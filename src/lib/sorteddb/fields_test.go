@@ -0,0 +1,46 @@
+package sorteddb
+
+import (
+	"testing"
+)
+
+func TestSplitFields(t *testing.T) {
+	db := &DB{RecordSeparator: ',', LineEnding: '\n'}
+	if fields := db.SplitFields([]byte("a,\"b,c\",d")); len(fields) != 4 {
+		t.Errorf("got fields %q", fields)
+	}
+
+	db.Quoted = true
+	fields := db.SplitFields([]byte("a,\"b,\"\"c\",,d"))
+	expected := []string{"a", "\"b,\"\"c\"", "", "d"}
+	if len(fields) != len(expected) {
+		t.Fatalf("got fields %q expected %q", fields, expected)
+	}
+	for i, f := range fields {
+		if string(f) != expected[i] {
+			t.Errorf("field %d got %q expected %q", i, f, expected[i])
+		}
+	}
+	if got := string(db.Unquote(fields[1])); got != "b,\"c" {
+		t.Errorf("Unquote got %q", got)
+	}
+}
+
+func TestSelectFields(t *testing.T) {
+	db := &DB{RecordSeparator: '\t', LineEnding: '\n'}
+	record := []byte("k\ta\tb\tc\td")
+	tests := []struct {
+		positions []int
+		expected  string
+	}{
+		{[]int{0}, "k"},
+		{[]int{1, 4}, "a\td"},
+		{[]int{3, 0}, "c\tk"},
+		{[]int{2, 9, 1}, "b\t\ta"},
+	}
+	for _, tt := range tests {
+		if got := string(db.SelectFields(record, tt.positions)); got != tt.expected {
+			t.Errorf("SelectFields(%v) got %q expected %q", tt.positions, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package sorteddb
+
+import (
+	"log"
+	"os"
+	"sync/atomic"
+
+	"github.com/riobard/go-mmap"
+)
+
+// generation is a single immutable mapping of the backing file. Readers hold
+// a reference for the duration of a query and the mapping is only unmapped
+// once the DB has swapped in a newer generation and the last reader is done.
+type generation struct {
+	id      uint64
+	f       *os.File
+	data    mmap.Mmap
+	size    int
+	start   int          // offset of the first record (after any header)
+	columns []string     // from the header row
+	records *recordTable // only for Quoted DBs
+	index   *sparseIndex
+	bloom   *bloomFilter
+	mlocked int32
+	refs    int32 // starts at 1 for the reference held by the DB
+}
+
+// acquire takes a reference to g, failing if g has already been released
+func (g *generation) acquire() bool {
+	for {
+		n := atomic.LoadInt32(&g.refs)
+		if n <= 0 {
+			return false
+		}
+		if atomic.CompareAndSwapInt32(&g.refs, n, n+1) {
+			return true
+		}
+	}
+}
+
+// release drops a reference to g, unmapping it when the last reference
+// is released.
+func (g *generation) release() error {
+	if atomic.AddInt32(&g.refs, -1) != 0 {
+		return nil
+	}
+	return g.close()
+}
+
+// close munlocks, unmaps and closes the backing file
+func (g *generation) close() (err error) {
+	if atomic.LoadInt32(&g.mlocked) == 1 {
+		g.data.Unlock() // nolint:errcheck
+	}
+	log.Printf("DB Unmmap %d bytes %s", g.size, g.f.Name())
+	err = g.data.Unmap()
+	log.Printf("Closing file %s", g.f.Name())
+	g.f.Close()
+	return
+}
+
+func (g *generation) mlock() error {
+	err := g.data.Lock()
+	if err == nil {
+		atomic.StoreInt32(&g.mlocked, 1)
+	}
+	return err
+}
+
+func (g *generation) munlock() error {
+	atomic.StoreInt32(&g.mlocked, 0)
+	return g.data.Unlock()
+}
+
+// acquire returns the current generation with a reference held, or nil if
+// the DB is not open. The caller must release the returned generation.
+func (db *DB) acquire() *generation {
+	for {
+		g := db.current()
+		if g == nil || g.acquire() {
+			return g
+		}
+		// g was released after being swapped out; try the new generation
+	}
+}
+
+// acquireOpen is like acquire but returns ErrClosed or ErrNotOpen when there
+// is no current generation.
+func (db *DB) acquireOpen() (*generation, error) {
+	g := db.acquire()
+	if g == nil {
+		return nil, db.notOpenErr()
+	}
+	return g, nil
+}
+
+// notOpenErr returns the error describing why the DB has no mapping
+func (db *DB) notOpenErr() error {
+	if atomic.LoadInt32(&db.closed) == 1 {
+		return ErrClosed
+	}
+	return ErrNotOpen
+}
+
+// current returns the current generation without taking a reference
+func (db *DB) current() *generation {
+	g, _ := db.generation.Load().(*generation)
+	return g
+}
+
+// swap atomically installs g as the current generation, releasing the DB's
+// reference to the previous generation.
+func (db *DB) swap(g *generation) error {
+	old := db.current()
+	db.generation.Store(g)
+	if old != nil {
+		return old.release()
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package sorteddb
+
+// readHeader records the column names from the first line of g and moves
+// the start of g past it
+func (db *DB) readHeader(g *generation) {
+	end := db.endOfLine(g, 0)
+	if end < 0 {
+		end = g.size
+	}
+	for _, field := range db.SplitFields(g.data[:end]) {
+		g.columns = append(g.columns, string(db.Unquote(field)))
+	}
+	g.start = end + 1
+	if g.start > g.size {
+		g.start = g.size
+	}
+}
+
+// Columns returns the column names from the header row when HasHeader is
+// set, or nil if there is no header or the DB is not mapped.
+func (db *DB) Columns() []string {
+	g := db.current()
+	if g == nil {
+		return nil
+	}
+	return g.columns
+}
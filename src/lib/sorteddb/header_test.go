@@ -0,0 +1,58 @@
+package sorteddb
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestHeader(t *testing.T) {
+	fTmp, err := ioutil.TempFile("testdata", "tmp_header")
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	defer os.Remove(fTmp.Name())
+	// the header sorts after the first record
+	fTmp.WriteString("id\tname\tscore\na\talice\t10\nb\tbob\t7\nj\tjoe\t3\n")
+
+	for _, interval := range []int{0, 1} {
+		db := &DB{RecordSeparator: '\t', LineEnding: '\n', HasHeader: true, IndexInterval: interval}
+		if err := db.Open(fTmp); err != nil {
+			t.Fatalf("got error %s", err)
+		}
+		defer db.Close()
+
+		columns := db.Columns()
+		if len(columns) != 3 || columns[0] != "id" || columns[1] != "name" || columns[2] != "score" {
+			t.Errorf("got columns %q", columns)
+		}
+		problems, err := db.Verify()
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+		for _, p := range problems {
+			t.Errorf("got problem %s", p)
+		}
+		if got := db.Search([]byte("id")); got != nil {
+			t.Errorf("Search(id) got %q expected no match", got)
+		}
+		if got, expected := string(db.Search([]byte("a"))), "a\talice\t10"; got != expected {
+			t.Errorf("Search(a) got %q expected %q", got, expected)
+		}
+		if got, expected := string(db.RangeMatch([]byte("0"), []byte("z"))), "a\talice\t10\nb\tbob\t7\nj\tjoe\t3\n"; got != expected {
+			t.Errorf("RangeMatch got %q expected %q", got, expected)
+		}
+
+		var keys []string
+		it := db.SeekReverse([]byte("z"))
+		for it.Next() {
+			keys = append(keys, string(it.Key()))
+		}
+		if len(keys) != 3 || keys[2] != "a" {
+			t.Errorf("got keys %q", keys)
+		}
+		if _, err := db.SeekOffset(db.Generation(), 0, false); err != ErrInvalidOffset {
+			t.Errorf("SeekOffset(0) got error %v expected %s", err, ErrInvalidOffset)
+		}
+	}
+}
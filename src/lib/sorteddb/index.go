@@ -0,0 +1,85 @@
+package sorteddb
+
+import (
+	"sort"
+	"time"
+)
+
+// sparseIndex holds the key and offset of every Nth record so that binary
+// searches can be narrowed to a small window before touching the mmap.
+type sparseIndex struct {
+	keys      []byte // all indexed keys concatenated
+	keyEnds   []int  // end of each key in keys
+	offsets   []int  // offset of each indexed record
+	buildTime time.Duration
+}
+
+// IndexStats describes the sparse index for the current mapping
+type IndexStats struct {
+	Entries   int
+	Bytes     int
+	BuildTime time.Duration
+}
+
+// buildIndex scans data recording the key of every interval'th line
+func (db *DB) buildIndex(g *generation, interval int) *sparseIndex {
+	start := time.Now()
+	idx := &sparseIndex{}
+	for i, line := g.start, 0; i < g.size; line++ {
+		end := db.endOfLine(g, i)
+		if end < 0 {
+			end = g.size
+		}
+		if line%interval == 0 {
+			idx.keys = append(idx.keys, db.recordKey(g.data[i:end])...)
+			idx.keyEnds = append(idx.keyEnds, len(idx.keys))
+			idx.offsets = append(idx.offsets, i)
+		}
+		i = end + 1
+	}
+	idx.buildTime = time.Since(start)
+	return idx
+}
+
+func (idx *sparseIndex) key(i int) []byte {
+	var start int
+	if i > 0 {
+		start = idx.keyEnds[i-1]
+	}
+	return idx.keys[start:idx.keyEnds[i]]
+}
+
+// window returns the range of offsets [lo, hi) that must contain the first
+// position matching isMatch (as evaluated by findFirstMatch), or hi if no
+// position in the window matches.
+func (idx *sparseIndex) window(start, size int, isMatch func([]byte) bool) (int, int) {
+	j := sort.Search(len(idx.offsets), func(i int) bool {
+		return isMatch(idx.key(i))
+	})
+	if j == 0 {
+		return start, start
+	}
+	hi := size
+	if j < len(idx.offsets) {
+		hi = idx.offsets[j]
+	}
+	return idx.offsets[j-1], hi
+}
+
+func (idx *sparseIndex) stats() IndexStats {
+	return IndexStats{
+		Entries:   len(idx.offsets),
+		Bytes:     len(idx.keys) + (len(idx.keyEnds)+len(idx.offsets))*8,
+		BuildTime: idx.buildTime,
+	}
+}
+
+// IndexStats returns the size and build time of the sparse index for the
+// current mapping. The zero value is returned if no index was built.
+func (db *DB) IndexStats() IndexStats {
+	g := db.current()
+	if g == nil || g.index == nil {
+		return IndexStats{}
+	}
+	return g.index.stats()
+}
@@ -0,0 +1,62 @@
+package sorteddb
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func openTestDB(t *testing.T, name string, indexInterval int) *DB {
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	db := &DB{RecordSeparator: '\t', LineEnding: '\n', IndexInterval: indexInterval}
+	if err := db.Open(f); err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	return db
+}
+
+// Tests that searches with a sparse index match those without
+func TestIndexedSearch(t *testing.T) {
+	needles := []string{"", "0", "a", "a0", "aa", "ab", "b", "c1", "prefix", "prefix.2", "prefix.3", "q", "y1",
+		"zzzzzz", "zzzzzzzzzzzzzzzzzzzzzzzzz", "zzzzzzzzzzzzzzzzzzzzzzzzzz", "zzzzzzzzzzzzzzzzzzzzzzzzzzzzzzz"}
+	for _, name := range []string{"testdata/testdb.tab", "testdata/char_test.tsv"} {
+		db := openTestDB(t, name, 0)
+		defer db.Close()
+		for _, interval := range []int{1, 2, 3, 7, 100} {
+			indexed := openTestDB(t, name, interval)
+			if stats := indexed.IndexStats(); stats.Entries == 0 {
+				t.Errorf("interval %d expected index entries", interval)
+			}
+			for _, needle := range needles {
+				n := []byte(needle)
+				if a, b := db.Search(n), indexed.Search(n); !bytes.Equal(a, b) {
+					t.Errorf("%s interval %d search %q got %q expected %q", name, interval, needle, b, a)
+				}
+				if a, b := db.ForwardMatch(n), indexed.ForwardMatch(n); !bytes.Equal(a, b) {
+					t.Errorf("%s interval %d forward match %q got %q expected %q", name, interval, needle, b, a)
+				}
+				if a, b := db.RangeMatch(n, []byte("q")), indexed.RangeMatch(n, []byte("q")); !bytes.Equal(a, b) {
+					t.Errorf("%s interval %d range %q got %q expected %q", name, interval, needle, b, a)
+				}
+			}
+			for i := 0; i <= 255; i++ {
+				n := []byte{byte(i)}
+				if a, b := db.Search(n), indexed.Search(n); !bytes.Equal(a, b) {
+					t.Errorf("%s interval %d search %q got %q expected %q", name, interval, n, b, a)
+				}
+			}
+			indexed.Close()
+		}
+	}
+
+	db := openTestDB(t, "testdata/char_test.tsv", 0)
+	indexed := openTestDB(t, "testdata/char_test.tsv", 16)
+	db.Search([]byte("q"))
+	indexed.Search([]byte("q"))
+	if indexed.SeekCount() >= db.SeekCount() {
+		t.Errorf("got %d seeks with index expected fewer than %d", indexed.SeekCount(), db.SeekCount())
+	}
+}
@@ -0,0 +1,195 @@
+package sorteddb
+
+import (
+	"errors"
+)
+
+// ErrRemapped is returned by SeekOffset when the DB has been remapped since
+// the offset was read.
+var ErrRemapped = errors.New("DB remapped during iteration")
+
+// ErrInvalidOffset is returned by SeekOffset when the offset does not refer
+// to the beginning of a record.
+var ErrInvalidOffset = errors.New("invalid record offset")
+
+// Iterator walks records in sorted (or reverse sorted) order. Each call to
+// Next copies a single record out of the mmap into a buffer that is reused
+// across calls, so arbitrarily large scans use a bounded amount of memory. The
+// iterator holds a reference to the mapping it was positioned on, so it is
+// unaffected by a Remap, until it is exhausted or closed.
+type Iterator struct {
+	db         *DB
+	g          *generation // released once exhausted or closed
+	generation uint64
+	offset     int // offset of the current record
+	next       int // offset of the next record; -1 when exhausted
+	reverse    bool
+	record     []byte
+	key        []byte
+	value      []byte
+	err        error
+	closed     bool
+	seeks      uint64 // made positioning the iterator
+}
+
+// Seek returns an Iterator positioned before the first record with a key
+// that sorts equal to or after needle.
+func (db *DB) Seek(needle []byte) *Iterator {
+	g := db.acquire()
+	if g == nil {
+		return &Iterator{db: db, next: -1, err: db.notOpenErr()}
+	}
+
+	it := &Iterator{db: db, g: g, generation: g.id, next: -1}
+	i := db.findStartOfRange(g, &it.seeks, needle)
+	if i >= 0 && i < g.size {
+		it.next = db.beginningOfLine(g, i)
+	}
+	it.releaseIfDone()
+	return it
+}
+
+// SeekReverse returns an Iterator that walks records in descending order
+// starting from the last record with a key that sorts equal to or before
+// needle.
+func (db *DB) SeekReverse(needle []byte) *Iterator {
+	g := db.acquire()
+	if g == nil {
+		return &Iterator{db: db, next: -1, reverse: true, err: db.notOpenErr()}
+	}
+
+	it := &Iterator{db: db, g: g, generation: g.id, next: -1, reverse: true}
+	it.next = db.previousRecord(g, db.recordBoundary(g, db.findEndOfRange(g, &it.seeks, needle)))
+	it.releaseIfDone()
+	return it
+}
+
+// SeekReversePrefix returns an Iterator that walks records in descending order
+// starting from the last record with a key that starts with prefix. Iteration
+// continues past the matching records; callers should stop once the key no
+// longer matches.
+func (db *DB) SeekReversePrefix(prefix []byte) *Iterator {
+	g := db.acquire()
+	if g == nil {
+		return &Iterator{db: db, next: -1, reverse: true, err: db.notOpenErr()}
+	}
+
+	it := &Iterator{db: db, g: g, generation: g.id, next: -1, reverse: true}
+	_, endRecord := db.forwardMatchRecords(g, &it.seeks, prefix)
+	it.next = db.previousRecord(g, db.recordBoundary(g, endRecord))
+	it.releaseIfDone()
+	return it
+}
+
+// SeekOffset returns an Iterator positioned at the record beginning at offset
+// (as previously returned by Iterator.Offset), walking in descending order if
+// reverse is set. ErrRemapped is returned if the DB is no longer at the given
+// generation.
+func (db *DB) SeekOffset(generation uint64, offset int, reverse bool) (*Iterator, error) {
+	g, err := db.acquireOpen()
+	if err != nil {
+		return nil, err
+	}
+	if g.id != generation {
+		g.release() // nolint:errcheck
+		return nil, ErrRemapped
+	}
+	if offset < g.start || offset >= g.size || !db.isRecordStart(g, offset) {
+		g.release() // nolint:errcheck
+		return nil, ErrInvalidOffset
+	}
+	return &Iterator{db: db, g: g, generation: generation, next: offset, reverse: reverse}, nil
+}
+
+// Seeks returns the number of seeks made positioning the iterator
+func (it *Iterator) Seeks() uint64 {
+	return it.seeks
+}
+
+// Next advances the iterator to the next record, returning false when there
+// are no more records or an error occurred. The slices returned by Key and
+// Value are only valid until the next call to Next.
+func (it *Iterator) Next() bool {
+	if it.closed || it.err != nil || it.next < 0 {
+		return false
+	}
+	db := it.db
+	g := it.g
+	defer it.releaseIfDone()
+
+	start := it.next
+	it.offset = start
+	end := db.endOfLine(g, start)
+	if end < 0 {
+		end = g.size
+	}
+	it.record = append(it.record[:0], g.data[start:end]...)
+	switch {
+	case it.reverse:
+		it.next = db.previousRecord(g, start)
+	case end+1 < g.size:
+		it.next = end + 1
+	default:
+		it.next = -1
+	}
+
+	it.key, it.value, _ = db.SplitKey(it.record)
+	return true
+}
+
+// Record returns the full current record (excluding the line ending)
+func (it *Iterator) Record() []byte {
+	return it.record
+}
+
+// Offset returns the byte offset of the current record which can be passed
+// to SeekOffset to resume iteration while the DB remains at the same
+// Generation.
+func (it *Iterator) Offset() int {
+	return it.offset
+}
+
+// Generation returns the DB generation the iterator is reading from
+func (it *Iterator) Generation() uint64 {
+	return it.generation
+}
+
+// Key returns the key of the current record
+func (it *Iterator) Key() []byte {
+	return it.key
+}
+
+// Value returns the current record excluding the key and record separator
+func (it *Iterator) Value() []byte {
+	return it.value
+}
+
+// Err returns the error, if any, that stopped iteration
+func (it *Iterator) Err() error {
+	return it.err
+}
+
+// releaseIfDone releases the mapping once there are no more records to read
+func (it *Iterator) releaseIfDone() {
+	if it.next < 0 {
+		it.release()
+	}
+}
+
+func (it *Iterator) release() {
+	if it.g != nil {
+		it.g.release() // nolint:errcheck
+		it.g = nil
+	}
+}
+
+// Close releases the iterator and its reference to the mapping. Subsequent
+// calls to Next return false.
+func (it *Iterator) Close() error {
+	it.closed = true
+	it.release()
+	it.record = nil
+	it.key = nil
+	it.value = nil
+	return nil
+}
@@ -0,0 +1,163 @@
+package sorteddb
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+type testIterate struct {
+	needle   string
+	limit    int
+	expected []string
+}
+
+func TestSeek(t *testing.T) {
+	f, err := os.Open("testdata/testdb.tab")
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	db, err := New(f)
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+
+	for _, tc := range []testIterate{
+		{"", 2, []string{"a", "aa"}},
+		{"prefix", 4, []string{"prefix.1", "prefix.2", "prefix.3", "q"}},
+		{"prefix.2", 1, []string{"prefix.2"}},
+		{"y1", 0, []string{"zzzzzzzzzzzzzzzzzzzzzzzz", "zzzzzzzzzzzzzzzzzzzzzzzzz", "zzzzzzzzzzzzzzzzzzzzzzzzzz"}},
+		{"zzzzzzzzzzzzzzzzzzzzzzzzzzzzzzz", 0, nil},
+	} {
+		it := db.Seek([]byte(tc.needle))
+		var keys []string
+		for it.Next() {
+			keys = append(keys, string(it.Key()))
+			if tc.limit > 0 && len(keys) == tc.limit {
+				break
+			}
+		}
+		if err := it.Err(); err != nil {
+			t.Errorf("seek %q got error %s", tc.needle, err)
+		}
+		it.Close()
+		if strings.Join(keys, ",") != strings.Join(tc.expected, ",") {
+			t.Errorf("seek %q got %q expected %q", tc.needle, keys, tc.expected)
+		}
+	}
+
+	it := db.Seek([]byte("prefix.3"))
+	if !it.Next() {
+		t.Fatalf("expected a record")
+	}
+	if string(it.Value()) != "you" || string(it.Record()) != "prefix.3\tyou" {
+		t.Errorf("got value %q record %q", it.Value(), it.Record())
+	}
+	if err := db.Remap(); err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	// the iterator keeps reading the mapping it was positioned on
+	if !it.Next() || string(it.Key()) != "q" {
+		t.Errorf("expected iteration to continue after remap got %q %v", it.Key(), it.Err())
+	}
+	if it.Generation() == db.Generation() {
+		t.Errorf("expected the iterator to be on the previous generation")
+	}
+	it.Close()
+	if it.Next() {
+		t.Errorf("expected iteration to stop after close")
+	}
+}
+
+func TestSeekReverse(t *testing.T) {
+	f, err := os.Open("testdata/testdb.tab")
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	db, err := New(f)
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+
+	for _, tc := range []testIterate{
+		{"", 0, nil},
+		{"0", 0, nil},
+		{"aa", 0, []string{"aa", "a"}},
+		{"b1", 2, []string{"b", "aa"}},
+		{"prefix.2", 2, []string{"prefix.2", "prefix.1"}},
+		{"zzzzzzzzzzzzzzzzzzzzzzzzzzzzzzz", 2, []string{"zzzzzzzzzzzzzzzzzzzzzzzzzz", "zzzzzzzzzzzzzzzzzzzzzzzzz"}},
+	} {
+		it := db.SeekReverse([]byte(tc.needle))
+		var keys []string
+		for it.Next() {
+			keys = append(keys, string(it.Key()))
+			if tc.limit > 0 && len(keys) == tc.limit {
+				break
+			}
+		}
+		if err := it.Err(); err != nil {
+			t.Errorf("seek reverse %q got error %s", tc.needle, err)
+		}
+		it.Close()
+		if strings.Join(keys, ",") != strings.Join(tc.expected, ",") {
+			t.Errorf("seek reverse %q got %q expected %q", tc.needle, keys, tc.expected)
+		}
+	}
+
+	for _, tc := range []testIterate{
+		{"pre", 4, []string{"prefix.3", "prefix.2", "prefix.1", "o"}},
+		{"y", 2, []string{"y", "w"}},
+		{"zzzzzz", 1, []string{"zzzzzzzzzzzzzzzzzzzzzzzzzz"}},
+		{"a", 0, []string{"aa", "a"}},
+	} {
+		it := db.SeekReversePrefix([]byte(tc.needle))
+		var keys []string
+		for it.Next() {
+			keys = append(keys, string(it.Key()))
+			if tc.limit > 0 && len(keys) == tc.limit {
+				break
+			}
+		}
+		it.Close()
+		if strings.Join(keys, ",") != strings.Join(tc.expected, ",") {
+			t.Errorf("seek reverse prefix %q got %q expected %q", tc.needle, keys, tc.expected)
+		}
+	}
+}
+
+func TestSeekOffset(t *testing.T) {
+	f, err := os.Open("testdata/testdb.tab")
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	db, err := New(f)
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+
+	it := db.Seek([]byte("prefix.2"))
+	if !it.Next() {
+		t.Fatalf("expected a record")
+	}
+	offset, generation := it.Offset(), it.Generation()
+	it.Close()
+
+	it, err = db.SeekOffset(generation, offset, true)
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	var keys []string
+	for it.Next() && len(keys) < 2 {
+		keys = append(keys, string(it.Key()))
+	}
+	if strings.Join(keys, ",") != "prefix.2,prefix.1" {
+		t.Errorf("got %q", keys)
+	}
+
+	if _, err := db.SeekOffset(generation, offset+1, false); err != ErrInvalidOffset {
+		t.Errorf("got error %v expected %v", err, ErrInvalidOffset)
+	}
+	if _, err := db.SeekOffset(generation+1, offset, false); err != ErrRemapped {
+		t.Errorf("got error %v expected %v", err, ErrRemapped)
+	}
+}
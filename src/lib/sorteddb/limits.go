@@ -0,0 +1,45 @@
+package sorteddb
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrLimitExceeded is returned when a query result is larger than its Limits
+var ErrLimitExceeded = errors.New("query result exceeds limit")
+
+// copyChunkSize is the number of bytes copied between checks for cancellation
+const copyChunkSize = 1 << 20
+
+// Limits bounds the size of a query result. Zero values are unlimited.
+type Limits struct {
+	MaxBytes   int
+	MaxRecords int
+}
+
+// copyRecords copies the records in g.data[start:end] in chunks, checking
+// ctx between chunks and enforcing limits.
+func (db *DB) copyRecords(ctx context.Context, g *generation, start, end int, limits Limits) ([]byte, error) {
+	if start >= end {
+		return nil, nil
+	}
+	if limits.MaxBytes > 0 && end-start > limits.MaxBytes {
+		return nil, ErrLimitExceeded
+	}
+	if limits.MaxRecords > 0 && db.countRecords(g, start, end) > limits.MaxRecords {
+		return nil, ErrLimitExceeded
+	}
+	buf := make([]byte, 0, end-start)
+	for i := start; i < end; {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		n := end - i
+		if n > copyChunkSize {
+			n = copyChunkSize
+		}
+		buf = append(buf, g.data[i:i+n]...)
+		i += n
+	}
+	return buf, nil
+}
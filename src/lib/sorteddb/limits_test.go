@@ -0,0 +1,51 @@
+package sorteddb
+
+import (
+	"context"
+	"os"
+	"testing"
+)
+
+func TestQueryLimits(t *testing.T) {
+	f, err := os.Open("testdata/testdb.tab")
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	db, err := New(f)
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	ctx := context.Background()
+
+	// "b".."e" matches 3 records totaling 16 bytes
+	for _, tc := range []struct {
+		limits   Limits
+		expected error
+	}{
+		{Limits{}, nil},
+		{Limits{MaxRecords: 3}, nil},
+		{Limits{MaxRecords: 2}, ErrLimitExceeded},
+		{Limits{MaxBytes: 16}, nil},
+		{Limits{MaxBytes: 15}, ErrLimitExceeded},
+	} {
+		records, err := db.RangeContext(ctx, []byte("b"), []byte("e"), tc.limits)
+		if err != tc.expected {
+			t.Errorf("limits %#v got error %v expected %v", tc.limits, err, tc.expected)
+		}
+		if err == nil && string(records) != "b\tthird\nc\td\ne\tf\n" {
+			t.Errorf("limits %#v got %q", tc.limits, records)
+		}
+	}
+	if _, err := db.PrefixContext(ctx, []byte("prefix"), Limits{MaxRecords: 2}); err != ErrLimitExceeded {
+		t.Errorf("got error %v expected %v", err, ErrLimitExceeded)
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := db.GetContext(canceled, []byte("a")); err != context.Canceled {
+		t.Errorf("got error %v expected %v", err, context.Canceled)
+	}
+	if _, err := db.PrefixContext(canceled, []byte("prefix"), Limits{}); err != context.Canceled {
+		t.Errorf("got error %v expected %v", err, context.Canceled)
+	}
+}
@@ -2,23 +2,68 @@ package sorteddb
 
 import (
 	"bytes"
+	"context"
 	"sort"
 	"sync/atomic"
 )
 
 // beginningOfLine locates the beginning of the line that includes i
-// by searching for the last line separator occurrence before i.
-func (db *DB) beginningOfLine(i int) int {
-	previous := lastIndexByte(db.data, i, db.LineEnding)
+// by searching for the last line separator occurrence before i (or from the
+// record table of a Quoted DB).
+func (db *DB) beginningOfLine(g *generation, i int) int {
+	if g.records != nil {
+		start, _ := db.findRecord(g, i)
+		return start
+	}
+	previous := lastIndexByte(g.data, i, db.LineEnding)
 	// returns the index to the first non-line-ending byte (or to the
 	// beginning of the DB if no line ending is found)
 	return previous + 1
 }
 
 // endOfLine locates the end of the line that includes i
-// by searching for the first line separator occurrence after i.
-func (db *DB) endOfLine(i int) int {
-	return indexByte(db.data, i, db.size, db.LineEnding)
+// by searching for the first line separator occurrence after i (or after the
+// closing quote of a Quoted DB).
+func (db *DB) endOfLine(g *generation, i int) int {
+	if g.records != nil {
+		start := db.beginningOfLine(g, i)
+		if end := start + db.recordLength(g.data[start:]); end < g.size {
+			return end
+		}
+		return -1
+	}
+	return indexByte(g.data, i, g.size, db.LineEnding)
+}
+
+// recordBoundary returns the offset of the beginning of the record that
+// includes i, or the end of the DB if i is out of range.
+func (db *DB) recordBoundary(g *generation, i int) int {
+	if i < 0 || i >= g.size {
+		return g.size
+	}
+	return db.beginningOfLine(g, i)
+}
+
+// isRecordStart returns true if a record begins at offset i
+func (db *DB) isRecordStart(g *generation, i int) bool {
+	if g.records != nil {
+		return db.beginningOfLine(g, i) == i
+	}
+	return i == g.start || (i > g.start && g.data[i-1] == db.LineEnding)
+}
+
+// previousRecord locates the beginning of the record immediately before the
+// record that starts at i (which may be the end of the DB), or -1 if there
+// is no such record.
+func (db *DB) previousRecord(g *generation, i int) int {
+	if i <= g.start {
+		return -1
+	}
+	i--
+	if g.data[i] == db.LineEnding {
+		i--
+	}
+	return db.beginningOfLine(g, i)
 }
 
 // lastIndexByte returns the index of the first instance of c in s before i. If
@@ -43,6 +88,38 @@ func indexByte(s []byte, i, m int, c byte) int {
 	return -1
 }
 
+// recordKey returns the key portion of a record
+func (db *DB) recordKey(record []byte) []byte {
+	key, _, _ := db.SplitKey(record)
+	return key
+}
+
+// hasKey returns true when record has a key equal to needle followed by a
+// RecordSeparator
+func (db *DB) hasKey(record []byte, needle []byte) bool {
+	key, _, ok := db.SplitKey(record)
+	return ok && bytes.Equal(key, needle)
+}
+
+// countRecords returns the number of records in g.data[start:end] where
+// start and end are record boundaries
+func (db *DB) countRecords(g *generation, start, end int) int {
+	if start >= end {
+		return 0
+	}
+	if g.records != nil {
+		_, first := db.findRecord(g, start)
+		_, last := db.findRecord(g, end-1)
+		return last - first + 1
+	}
+	n := bytes.Count(g.data[start:end], []byte{db.LineEnding})
+	if end == g.size && g.data[end-1] != db.LineEnding {
+		// last record without a trailing line ending
+		n++
+	}
+	return n
+}
+
 // Copies all bytes in s to a new destination buffer
 func makeCopy(s []byte) []byte {
 	d := make([]byte, len(s))
@@ -53,45 +130,50 @@ func makeCopy(s []byte) []byte {
 // findFirstMatch performs a binary search to find the first record
 // that matches needle using the given isMatch function, or -1 if
 // no match is found.
-func (db *DB) findFirstMatch(needle []byte, isMatch func([]byte) bool) int {
-	needleLen := len(needle)
+func (db *DB) findFirstMatch(g *generation, seeks *uint64, isMatch func([]byte) bool) int {
+	return db.findFirstMatchAfter(g, seeks, g.start, isMatch)
+}
 
+// findFirstMatchAfter is like findFirstMatch but only searches from offset lo
+// (the beginning of a record) for when no earlier record can match.
+func (db *DB) findFirstMatchAfter(g *generation, seeks *uint64, lo int, isMatch func([]byte) bool) int {
 	// binary search to find the index that matches our needle,
 	// starting at the previous line.
 	// note: this could be more efficient if we wrote our own search as we could
 	// skip data we've checked instead of checking potentially more indexes here.
 	// Because page size is 4k this should hopefully matter less.
-	return sort.Search(db.size, func(i int) bool {
+	hi := g.size
+	if g.index != nil {
+		// narrow the search to the window between two indexed records
+		var windowLo int
+		windowLo, hi = g.index.window(g.start, g.size, isMatch)
+		if windowLo > lo {
+			lo = windowLo
+		}
+		if hi < lo {
+			hi = lo
+		}
+	}
+	return lo + sort.Search(hi-lo, func(i int) bool {
+		i += lo
 		// find previous line starting point
-		atomic.AddUint64(&db.seekCount, 1)
+		db.countSeek(seeks)
 
-		startOfKey := db.beginningOfLine(i)
+		startOfKey := db.beginningOfLine(g, i)
 
-		// make sure we have space before end of the buffer
-		if startOfKey+1+needleLen > db.size {
+		// past the last record. Keys are compared through isMatch (rather
+		// than by length) as they may sort equally to a longer needle (eg:
+		// in NumericOrder) or be unquoted.
+		if startOfKey >= g.size {
 			return false
 		}
 
-		// The list of delimiters that can end a key
-		d := [...]byte{
-			db.RecordSeparator,
-			db.LineEnding,
-		}
-
-		// Find the first delimiter that occurs after the start of this key by
-		// searching for each delimiter and taking the minimum index that isn't -1
-		endOfKey := -1
-		for _, e := range d {
-			i := indexByte(db.data, startOfKey, db.size, e)
-			if i != -1 && (endOfKey < 0 || i < endOfKey) {
-				endOfKey = i
-			}
-		}
+		endOfKey := db.endOfLine(g, startOfKey)
 		if endOfKey < 0 {
-			// If no delimiter was found, just seek to the end of the DB
-			endOfKey = db.size
+			// If no line ending was found, just seek to the end of the DB
+			endOfKey = g.size
 		}
-		return isMatch(db.data[startOfKey:endOfKey])
+		return isMatch(db.recordKey(g.data[startOfKey:endOfKey]))
 	})
 }
 
@@ -99,9 +181,9 @@ func (db *DB) findFirstMatch(needle []byte, isMatch func([]byte) bool) int {
 // greater than startNeedle.
 // In other words, it finds the first record in the range started by
 // startNeedle.
-func (db *DB) findStartOfRange(startNeedle []byte) int {
-	return db.findFirstMatch(startNeedle, func(key []byte) bool {
-		return bytes.Compare(key, startNeedle) >= 0
+func (db *DB) findStartOfRange(g *generation, seeks *uint64, startNeedle []byte) int {
+	return db.findFirstMatch(g, seeks, func(key []byte) bool {
+		return db.Compare(key, startNeedle) >= 0
 	})
 }
 
@@ -109,15 +191,15 @@ func (db *DB) findStartOfRange(startNeedle []byte) int {
 // endNeedle.
 // In other words, it finds the first record beyond the range ended by
 // endNeedle.
-func (db *DB) findEndOfRange(endNeedle []byte) int {
-	return db.findFirstMatch(endNeedle, func(key []byte) bool {
-		return bytes.Compare(key, endNeedle) > 0
+func (db *DB) findEndOfRange(g *generation, seeks *uint64, endNeedle []byte) int {
+	return db.findFirstMatch(g, seeks, func(key []byte) bool {
+		return db.Compare(key, endNeedle) > 0
 	})
 }
 
 // forwardMatchRecords gets the start and end indices of all records that
 // needle forward (prefix) matches.
-func (db *DB) forwardMatchRecords(needle []byte) (int, int) {
+func (db *DB) forwardMatchRecords(g *generation, seeks *uint64, needle []byte) (int, int) {
 	needleLen := len(needle)
 
 	// To find the range of records that forward matches, we'll perform two
@@ -128,104 +210,257 @@ func (db *DB) forwardMatchRecords(needle []byte) (int, int) {
 	// (records where prefix == needle)
 
 	// Find the first record where the prefix is equal to or greater than needle
-	startIndex := db.findFirstMatch(needle, func(key []byte) bool {
+	startIndex := db.findFirstMatch(g, seeks, func(key []byte) bool {
 		if len(key) > needleLen {
 			key = key[:needleLen]
 		}
-		return bytes.Compare(key, needle) >= 0
+		return db.Compare(key, needle) >= 0
 	})
 
 	// Find the first record where the prefix is STRICTLY greater than needle
-	endIndex := db.findFirstMatch(needle, func(key []byte) bool {
+	endIndex := db.findFirstMatch(g, seeks, func(key []byte) bool {
 		if len(key) > needleLen {
 			key = key[:needleLen]
 		}
-		return bytes.Compare(key, needle) > 0
+		return db.Compare(key, needle) > 0
 	})
 
 	return startIndex, endIndex
 }
 
 // Search uses a binary search looking for needle, and returns the full match line.
+// It panics if the DB is not open; see Get for a variant that returns an error.
 func (db *DB) Search(needle []byte) []byte {
-	db.mutex.RLock()
+	line, err := db.Get(needle)
+	if err != nil {
+		panic(err)
+	}
+	return line
+}
+
+// Get uses a binary search looking for needle, and returns the full match
+// line, or nil if there is no match. ErrNotOpen or ErrClosed is returned
+// if the DB is not mapped.
+func (db *DB) Get(needle []byte) ([]byte, error) {
+	return db.GetContext(context.Background(), needle)
+}
 
-	if db.size <= 0 {
-		panic("DB not Mapped")
+// GetContext is like Get but returns ctx.Err() if ctx is done before the
+// search starts.
+func (db *DB) GetContext(ctx context.Context, needle []byte) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
-	i := db.findStartOfRange(needle)
-	if i < 0 || i == db.size {
-		db.mutex.RUnlock()
-		return nil
+	g, err := db.acquireOpen()
+	if err != nil {
+		return nil, err
 	}
-	previous := db.beginningOfLine(i)
+	defer g.release() // nolint:errcheck
 
-	lineEnd := db.endOfLine(previous)
-	// copy data before unlocking to avoid race conditions
-	line := makeCopy(db.data[previous:lineEnd])
-	db.mutex.RUnlock()
+	if g.bloom != nil && !g.bloom.test(needle) {
+		atomic.AddUint64(&db.bloomSkips, 1)
+		return nil, nil
+	}
+	i := db.findStartOfRange(g, seekCounter(ctx), needle)
+	if i < 0 || i == g.size {
+		return nil, nil
+	}
+	return db.exactMatch(g, db.beginningOfLine(g, i), needle), nil
+}
 
-	if len(line) > len(needle) && bytes.Equal(line[:len(needle)], needle) &&
-		line[len(needle)] == db.RecordSeparator {
-		return line
+// exactMatch returns a copy of the first record with a key equal to needle
+// starting from the record at offset i, the first with a key that sorts
+// equal to or after needle.
+func (db *DB) exactMatch(g *generation, i int, needle []byte) []byte {
+	// keys that sort equally to needle (eg: "1" and "01" in NumericOrder)
+	// are adjacent; look through them for an exact match
+	for previous := i; previous < g.size; {
+		lineEnd := db.endOfLine(g, previous)
+		if lineEnd < 0 {
+			lineEnd = g.size
+		}
+		line := g.data[previous:lineEnd]
+		if db.hasKey(line, needle) {
+			// copy data before releasing the mapping to avoid race conditions
+			return makeCopy(line)
+		}
+		if db.Compare(db.recordKey(line), needle) != 0 {
+			break
+		}
+		previous = lineEnd + 1
 	}
 	return nil
 }
 
+// SearchAll returns every record with a key equal to needle. Unlike Search
+// which returns only the first matching line, this allows one key to map to
+// many records. It panics if the DB is not open; see GetAll for a variant
+// that returns an error.
+func (db *DB) SearchAll(needle []byte) [][]byte {
+	records, err := db.GetAll(needle)
+	if err != nil {
+		panic(err)
+	}
+	return records
+}
+
+// GetAll returns every record with a key equal to needle. ErrNotOpen or
+// ErrClosed is returned if the DB is not mapped.
+func (db *DB) GetAll(needle []byte) ([][]byte, error) {
+	return db.GetAllContext(context.Background(), needle, Limits{})
+}
+
+// GetAllContext is like GetAll but stops with ctx.Err() if ctx is done while
+// copying records, or ErrLimitExceeded if the result exceeds limits.
+func (db *DB) GetAllContext(ctx context.Context, needle []byte, limits Limits) ([][]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	g, err := db.acquireOpen()
+	if err != nil {
+		return nil, err
+	}
+	defer g.release() // nolint:errcheck
+
+	if g.bloom != nil && !g.bloom.test(needle) {
+		atomic.AddUint64(&db.bloomSkips, 1)
+		return nil, nil
+	}
+	seeks := seekCounter(ctx)
+	startRecord := db.findStartOfRange(g, seeks, needle)
+	if startRecord < 0 || startRecord == g.size {
+		return nil, nil
+	}
+	startIndex := db.beginningOfLine(g, startRecord)
+	endIndex := db.recordBoundary(g, db.findEndOfRange(g, seeks, needle))
+	if endIndex <= startIndex {
+		return nil, nil
+	}
+	// copy data before releasing the mapping to avoid race conditions
+	data, err := db.copyRecords(ctx, g, startIndex, endIndex, limits)
+	if err != nil {
+		return nil, err
+	}
+
+	var records [][]byte
+	for len(data) > 0 {
+		line := data
+		if i := db.recordLength(data); i < len(data) {
+			line, data = data[:i], data[i+1:]
+		} else {
+			data = nil
+		}
+		if db.hasKey(line, needle) {
+			records = append(records, line)
+		}
+	}
+	return records, nil
+}
+
 // ForwardMatch retrieves all records that have keys starting with needle.
+// It panics if the DB is not open; see Prefix for a variant that returns
+// an error.
 func (db *DB) ForwardMatch(needle []byte) []byte {
-	db.mutex.RLock()
+	records, err := db.Prefix(needle)
+	if err != nil {
+		panic(err)
+	}
+	return records
+}
+
+// Prefix retrieves all records that have keys starting with needle (as
+// compared by the DB Comparator, so only meaningful for ByteOrder and
+// CaseFoldOrder). ErrNotOpen or ErrClosed is returned if the DB is not mapped.
+func (db *DB) Prefix(needle []byte) ([]byte, error) {
+	return db.PrefixContext(context.Background(), needle, Limits{})
+}
 
-	if db.size <= 0 {
-		panic("DB not Mapped")
+// PrefixContext is like Prefix but stops with ctx.Err() if ctx is done while
+// copying records, or ErrLimitExceeded if the result exceeds limits.
+func (db *DB) PrefixContext(ctx context.Context, needle []byte, limits Limits) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
-	startRecord, endRecord := db.forwardMatchRecords(needle)
-	if startRecord < 0 || startRecord == db.size {
-		db.mutex.RUnlock()
-		return nil
+	g, err := db.acquireOpen()
+	if err != nil {
+		return nil, err
 	}
-	startIndex := db.beginningOfLine(startRecord)
+	defer g.release() // nolint:errcheck
+
+	startIndex, endIndex := db.prefixBounds(g, seekCounter(ctx), needle)
+	// copy data before releasing the mapping to avoid race conditions
+	return db.copyRecords(ctx, g, startIndex, endIndex, limits)
+}
 
-	endIndex := db.size
-	if endRecord >= 0 && endRecord < db.size {
-		endIndex = db.beginningOfLine(endRecord)
+// prefixBounds returns the offsets [start, end) spanning all records that
+// have keys starting with needle
+func (db *DB) prefixBounds(g *generation, seeks *uint64, needle []byte) (int, int) {
+	startRecord, endRecord := db.forwardMatchRecords(g, seeks, needle)
+	if startRecord < 0 || startRecord == g.size {
+		return 0, 0
 	}
-	// copy data before unlocking to avoid race conditions
-	records := makeCopy(db.data[startIndex:endIndex])
-	db.mutex.RUnlock()
+	startIndex := db.beginningOfLine(g, startRecord)
 
-	return records
+	endIndex := g.size
+	if endRecord >= 0 && endRecord < g.size {
+		endIndex = db.beginningOfLine(g, endRecord)
+	}
+	return startIndex, endIndex
 }
 
 // RangeMatch uses binary searches to look for startNeedle and (if not nil)
 // endNeedle. Returns all full match lines that fall between startNeedle and
-// endNeedle, inclusive.
+// endNeedle, inclusive. It panics if the DB is not open; see Range for a
+// variant that returns an error.
 func (db *DB) RangeMatch(startNeedle []byte, endNeedle []byte) []byte {
-	db.mutex.RLock()
+	records, err := db.Range(startNeedle, endNeedle)
+	if err != nil {
+		panic(err)
+	}
+	return records
+}
+
+// Range returns all full match lines that fall between startNeedle and
+// endNeedle, inclusive. ErrNotOpen or ErrClosed is returned if the DB is
+// not mapped.
+func (db *DB) Range(startNeedle []byte, endNeedle []byte) ([]byte, error) {
+	return db.RangeContext(context.Background(), startNeedle, endNeedle, Limits{})
+}
 
-	if db.size <= 0 {
-		panic("DB not Mapped")
+// RangeContext is like Range but stops with ctx.Err() if ctx is done while
+// copying records, or ErrLimitExceeded if the result exceeds limits.
+func (db *DB) RangeContext(ctx context.Context, startNeedle []byte, endNeedle []byte, limits Limits) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
-	if bytes.Compare(startNeedle, endNeedle) > 0 {
+	g, err := db.acquireOpen()
+	if err != nil {
+		return nil, err
+	}
+	defer g.release() // nolint:errcheck
+
+	startIndex, endIndex := db.rangeBounds(g, seekCounter(ctx), startNeedle, endNeedle)
+	// copy data before releasing the mapping to avoid race conditions
+	return db.copyRecords(ctx, g, startIndex, endIndex, limits)
+}
+
+// rangeBounds returns the offsets [start, end) spanning all records that
+// fall between startNeedle and endNeedle, inclusive
+func (db *DB) rangeBounds(g *generation, seeks *uint64, startNeedle []byte, endNeedle []byte) (int, int) {
+	if db.Compare(startNeedle, endNeedle) > 0 {
 		// end is smaller than start, so the range is ill-defined
-		db.mutex.RUnlock()
-		return nil
+		return 0, 0
 	}
-	startRecord := db.findStartOfRange(startNeedle)
-	if startRecord < 0 || startRecord == db.size {
-		db.mutex.RUnlock()
-		return nil
+	startRecord := db.findStartOfRange(g, seeks, startNeedle)
+	if startRecord < 0 || startRecord == g.size {
+		return 0, 0
 	}
-	startIndex := db.beginningOfLine(startRecord)
+	startIndex := db.beginningOfLine(g, startRecord)
 
-	endIndex := db.size
-	endRecord := db.findEndOfRange(endNeedle)
-	if endRecord >= 0 && endRecord < db.size {
-		endIndex = db.beginningOfLine(endRecord)
+	endIndex := g.size
+	endRecord := db.findEndOfRange(g, seeks, endNeedle)
+	if endRecord >= 0 && endRecord < g.size {
+		endIndex = db.beginningOfLine(g, endRecord)
 	}
-	// copy data before unlocking to avoid race conditions
-	records := makeCopy(db.data[startIndex:endIndex])
-	db.mutex.RUnlock()
-
-	return records
+	return startIndex, endIndex
 }
@@ -5,6 +5,7 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -61,6 +62,35 @@ func TestSearch(t *testing.T) {
 
 }
 
+func TestSearchAll(t *testing.T) {
+	fTmp, err := ioutil.TempFile("testdata", "tmp_testdb")
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	defer os.Remove(fTmp.Name())
+	fTmp.WriteString("a\t1\nb\t1\nb\t2\nb\t3\nbb\t4\nc\t5\n")
+
+	db, err := New(fTmp)
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	for _, tc := range []testSearch{
+		{"a", "a\t1"},
+		{"b", "b\t1,b\t2,b\t3"},
+		{"bb", "bb\t4"},
+		{"c", "c\t5"},
+		{"d", ""},
+	} {
+		var records []string
+		for _, r := range db.SearchAll([]byte(tc.needle)) {
+			records = append(records, string(r))
+		}
+		if strings.Join(records, ",") != tc.expected {
+			t.Errorf("query %q got %q expected %q", tc.needle, records, tc.expected)
+		}
+	}
+}
+
 // Tests that slices returned by Search aren't modified by changes
 // to the DB file afterwards.
 func TestSearchWhileWriting(t *testing.T) {
@@ -0,0 +1,105 @@
+package sorteddb
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// ProblemKind identifies the type of issue found by Verify
+type ProblemKind int
+
+const (
+	OutOfOrder ProblemKind = iota
+	DuplicateKey
+	EmptyLine
+	MissingRecordSeparator
+	MissingTrailingNewline
+)
+
+func (k ProblemKind) String() string {
+	switch k {
+	case OutOfOrder:
+		return "out of order"
+	case DuplicateKey:
+		return "duplicate key"
+	case EmptyLine:
+		return "empty line"
+	case MissingRecordSeparator:
+		return "missing record separator"
+	case MissingTrailingNewline:
+		return "missing trailing newline"
+	}
+	return fmt.Sprintf("ProblemKind(%d)", int(k))
+}
+
+// Problem describes an issue with the format or ordering of the DB file
+type Problem struct {
+	Kind     ProblemKind
+	Line     int    // 1 based line number (of the first line of a quoted record)
+	Offset   int    // byte offset of the beginning of the line
+	Key      []byte // key of the line
+	Previous []byte // key of the preceding record for OutOfOrder and DuplicateKey
+}
+
+func (p Problem) String() string {
+	switch p.Kind {
+	case OutOfOrder:
+		return fmt.Sprintf("line %d (offset %d): %s: %q sorts before %q", p.Line, p.Offset, p.Kind, p.Key, p.Previous)
+	case DuplicateKey:
+		return fmt.Sprintf("line %d (offset %d): %s %q", p.Line, p.Offset, p.Kind, p.Key)
+	}
+	return fmt.Sprintf("line %d (offset %d): %s", p.Line, p.Offset, p.Kind)
+}
+
+// Verify scans the entire DB checking that records are sorted according to
+// the DB Comparator (byte order by default) and well formed. Only the first
+// out of order pair is reported as every following comparison is suspect once
+// the ordering is broken.
+func (db *DB) Verify() ([]Problem, error) {
+	g, err := db.acquireOpen()
+	if err != nil {
+		return nil, err
+	}
+	defer g.release() // nolint:errcheck
+
+	var problems []Problem
+	var previous []byte
+	var havePrevious, outOfOrder bool
+	// skip the header row (which may span lines when quoted)
+	line := bytes.Count(g.data[:g.start], []byte{db.LineEnding})
+	for start := g.start; start < g.size; {
+		line++
+		end := db.endOfLine(g, start)
+		if end < 0 {
+			end = g.size
+			problems = append(problems, Problem{Kind: MissingTrailingNewline, Line: line, Offset: start})
+		}
+		record := g.data[start:end]
+		if len(record) == 0 {
+			problems = append(problems, Problem{Kind: EmptyLine, Line: line, Offset: start})
+			start = end + 1
+			continue
+		}
+		key, _, ok := db.SplitKey(record)
+		if !ok {
+			problems = append(problems, Problem{Kind: MissingRecordSeparator, Line: line, Offset: start, Key: makeCopy(key)})
+		}
+		if havePrevious {
+			switch c := db.Compare(previous, key); {
+			case c == 0 && bytes.Equal(previous, key):
+				problems = append(problems, Problem{Kind: DuplicateKey, Line: line, Offset: start, Key: makeCopy(key), Previous: makeCopy(previous)})
+			case c > 0 && !outOfOrder:
+				outOfOrder = true
+				problems = append(problems, Problem{Kind: OutOfOrder, Line: line, Offset: start, Key: makeCopy(key), Previous: makeCopy(previous)})
+			}
+		}
+		previous = key
+		havePrevious = true
+		if db.Quoted {
+			// quoted fields may contain line endings
+			line += bytes.Count(record, []byte{db.LineEnding})
+		}
+		start = end + 1
+	}
+	return problems, nil
+}
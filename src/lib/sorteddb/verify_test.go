@@ -0,0 +1,61 @@
+package sorteddb
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+	for _, name := range []string{"testdata/testdb.tab", "testdata/char_test.tsv"} {
+		f, err := os.Open(name)
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+		db, err := New(f)
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+		problems, err := db.Verify()
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+		for _, p := range problems {
+			t.Errorf("%s: %s", name, p)
+		}
+		db.Close()
+	}
+}
+
+func TestVerifyProblems(t *testing.T) {
+	fTmp, err := ioutil.TempFile("testdata", "tmp_verify")
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	defer os.Remove(fTmp.Name())
+	fTmp.WriteString("a\t1\nc\t2\nc\t3\n\nb\t4\nd\ne\t5\nA\t6")
+
+	db, err := New(fTmp)
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	problems, err := db.Verify()
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	expected := []Problem{
+		{Kind: DuplicateKey, Line: 3, Offset: 8},
+		{Kind: EmptyLine, Line: 4, Offset: 12},
+		{Kind: OutOfOrder, Line: 5, Offset: 13},
+		{Kind: MissingRecordSeparator, Line: 6, Offset: 17},
+		{Kind: MissingTrailingNewline, Line: 8, Offset: 23},
+	}
+	if len(problems) != len(expected) {
+		t.Fatalf("got %d problems %v expected %d", len(problems), problems, len(expected))
+	}
+	for i, p := range problems {
+		if p.Kind != expected[i].Kind || p.Line != expected[i].Line || p.Offset != expected[i].Offset {
+			t.Errorf("got %s expected %s", p, expected[i])
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package sorteddb
+
+import (
+	"context"
+	"io"
+)
+
+// WritePrefixTo writes all records that have keys starting with needle to w
+// directly from the mapping, without copying the result into memory. The
+// mapping being written from remains valid until WritePrefixTo returns even
+// if the DB is remapped. Limits are checked before anything is written;
+// if ctx is done part way through, ctx.Err() is returned along with the
+// number of bytes already written.
+func (db *DB) WritePrefixTo(ctx context.Context, w io.Writer, needle []byte, limits Limits) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	g, err := db.acquireOpen()
+	if err != nil {
+		return 0, err
+	}
+	defer g.release() // nolint:errcheck
+
+	startIndex, endIndex := db.prefixBounds(g, seekCounter(ctx), needle)
+	return db.writeRecords(ctx, w, g, startIndex, endIndex, limits)
+}
+
+// WriteRangeTo writes all records between startNeedle and endNeedle,
+// inclusive, to w directly from the mapping. See WritePrefixTo.
+func (db *DB) WriteRangeTo(ctx context.Context, w io.Writer, startNeedle []byte, endNeedle []byte, limits Limits) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	g, err := db.acquireOpen()
+	if err != nil {
+		return 0, err
+	}
+	defer g.release() // nolint:errcheck
+
+	startIndex, endIndex := db.rangeBounds(g, seekCounter(ctx), startNeedle, endNeedle)
+	return db.writeRecords(ctx, w, g, startIndex, endIndex, limits)
+}
+
+// writeRecords writes g.data[start:end] to w in chunks, checking ctx between
+// chunks.
+func (db *DB) writeRecords(ctx context.Context, w io.Writer, g *generation, start, end int, limits Limits) (int64, error) {
+	if start >= end {
+		return 0, nil
+	}
+	if limits.MaxBytes > 0 && end-start > limits.MaxBytes {
+		return 0, ErrLimitExceeded
+	}
+	if limits.MaxRecords > 0 && db.countRecords(g, start, end) > limits.MaxRecords {
+		return 0, ErrLimitExceeded
+	}
+	var written int64
+	for i := start; i < end; {
+		if err := ctx.Err(); err != nil {
+			return written, err
+		}
+		n := end - i
+		if n > copyChunkSize {
+			n = copyChunkSize
+		}
+		n, err := w.Write(g.data[i : i+n])
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+		i += n
+	}
+	return written, nil
+}
@@ -0,0 +1,50 @@
+package sorteddb
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"testing"
+)
+
+func TestWriteTo(t *testing.T) {
+	f, err := os.Open("testdata/testdb.tab")
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	db, err := New(f)
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	ctx := context.Background()
+
+	for _, tc := range []testRangeSearch{
+		{"0", "9", ""},
+		{"b", "c1", "b\tthird\nc\td\n"},
+		{"c", "b", ""},
+		{"y1", "zzzzzzzzzzzzzzzzzzzzzzzz", "zzzzzzzzzzzzzzzzzzzzzzzz\talmost-sleepy\n"},
+	} {
+		var buf bytes.Buffer
+		n, err := db.WriteRangeTo(ctx, &buf, []byte(tc.startNeedle), []byte(tc.endNeedle), Limits{})
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+		if buf.String() != tc.expected || n != int64(len(tc.expected)) {
+			t.Errorf("range %q-%q wrote %d %q expected %q", tc.startNeedle, tc.endNeedle, n, buf.String(), tc.expected)
+		}
+	}
+
+	var buf bytes.Buffer
+	if _, err := db.WritePrefixTo(ctx, &buf, []byte("pre"), Limits{}); err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	if buf.String() != "prefix.1\thow\nprefix.2\tare\nprefix.3\tyou\n" {
+		t.Errorf("got %q", buf.String())
+	}
+
+	buf.Reset()
+	n, err := db.WritePrefixTo(ctx, &buf, []byte("pre"), Limits{MaxRecords: 2})
+	if err != ErrLimitExceeded || n != 0 || buf.Len() != 0 {
+		t.Errorf("got %d %v expected %v", n, err, ErrLimitExceeded)
+	}
+}